@@ -0,0 +1,263 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	operatorsv1alpha1 "github.com/operator-framework/api/pkg/operators/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// controllerLabels selects the controller Deployment created by the
+// operator-sdk manifests (make deploy)
+var controllerLabels = client.MatchingLabels{"control-plane": "controller-manager"}
+
+// olmRemovalSteps are the steps removing the ansible operator installed by OLM
+var olmRemovalSteps = []string{"getCurrentCSV", "deleteSubscription", "deleteCSV"}
+
+// ansibleOperator holds the resources of an ansible operator deployed without
+// OLM, recorded before they are deleted so they can be recreated by rollback
+type ansibleOperator struct {
+	Deployment     *appsv1.Deployment     `json:"deployment,omitempty"`
+	ServiceAccount *corev1.ServiceAccount `json:"serviceAccount,omitempty"`
+	Roles          []rbacv1.Role          `json:"roles,omitempty"`
+	RoleBindings   []rbacv1.RoleBinding   `json:"roleBindings,omitempty"`
+}
+
+// manifests returns the resources of the operator, in the order they should
+// be created, with only the fields that can be provided when recreating them
+func (operator ansibleOperator) manifests() []client.Object {
+	objs := []client.Object{}
+	if operator.ServiceAccount != nil {
+		objs = append(objs, &corev1.ServiceAccount{
+			ObjectMeta:       cleanObjectMeta(operator.ServiceAccount.ObjectMeta),
+			ImagePullSecrets: operator.ServiceAccount.ImagePullSecrets,
+		})
+	}
+	for _, role := range operator.Roles {
+		objs = append(objs, &rbacv1.Role{ObjectMeta: cleanObjectMeta(role.ObjectMeta), Rules: role.Rules})
+	}
+	for _, binding := range operator.RoleBindings {
+		objs = append(objs, &rbacv1.RoleBinding{ObjectMeta: cleanObjectMeta(binding.ObjectMeta), Subjects: binding.Subjects, RoleRef: binding.RoleRef})
+	}
+	if operator.Deployment != nil {
+		objs = append(objs, &appsv1.Deployment{ObjectMeta: cleanObjectMeta(operator.Deployment.ObjectMeta), Spec: operator.Deployment.Spec})
+	}
+	return objs
+}
+
+// findAnsibleOperator returns the controller Deployment of the operator
+// deployed without OLM in the namespace, or nil if there is none.
+// Its name is prefixed by the operator name (like pulp-operator-controller-manager).
+func findAnsibleOperator(c cluster, namespace, operator string) (*appsv1.Deployment, error) {
+	deploymentList := &appsv1.DeploymentList{}
+	if err := c.List(context.TODO(), deploymentList, client.InNamespace(namespace), controllerLabels); err != nil {
+		return nil, fmt.Errorf("failed to list the controller deployments: %w", err)
+	}
+	for i := range deploymentList.Items {
+		if ownedByCSV(deploymentList.Items[i]) || isGolangOperator(deploymentList.Items[i]) {
+			continue
+		}
+		if strings.HasPrefix(deploymentList.Items[i].Name, operator) {
+			return &deploymentList.Items[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// ownedByCSV returns true if the Deployment was created by OLM for a
+// ClusterServiceVersion, so OLM recreates it until the CSV is deleted
+func ownedByCSV(deployment appsv1.Deployment) bool {
+	if _, ok := deployment.Labels["olm.owner"]; ok {
+		return true
+	}
+	for _, owner := range deployment.OwnerReferences {
+		if owner.Kind == operatorsv1alpha1.ClusterServiceVersionKind {
+			return true
+		}
+	}
+	return false
+}
+
+// isGolangOperator returns true if the Deployment is the controller of the
+// golang operator, it has the same name and labels as the ansible one
+func isGolangOperator(deployment appsv1.Deployment) bool {
+	return deployment.Labels["app.kubernetes.io/component"] == "operator"
+}
+
+// detectOLM checks if OLM is installed, otherwise the golang operator is
+// installed from its manifests, and if the ansible operator was installed
+// through it. Without its Subscription (or without OLM at all), the controller
+// Deployment created by make deploy is looked up instead.
+func (pulp *pulp) detectOLM(c cluster) error {
+	installed, err := olmInstalled(c)
+	if err != nil {
+		fmt.Println("❌ Failed to find the OLM API:", err)
+		return fmt.Errorf("failed to find the OLM API: %w", err)
+	}
+	if !installed && !pulp.sharedSubscription {
+		fmt.Println("⚠️  OLM is not installed, migrator will install the golang operator from its manifests")
+	}
+	pulp.installManifests = !installed
+
+	// found by a previous run, the Deployment could be already deleted
+	if pulp.original.AnsibleOperator != nil {
+		pulp.withoutOLM = true
+		return nil
+	}
+	// the operator was already removed with the first Pulp CR (batch mode)
+	if pulp.sharedSubscription {
+		return nil
+	}
+	// the Subscription was removed by a previous run, the CSV is deleted
+	// by the remaining steps
+	if pulp.original.CSVName != "" {
+		return nil
+	}
+	for _, step := range olmRemovalSteps {
+		if pulp.checkpoint.completed(step) {
+			return nil
+		}
+	}
+
+	err = c.Get(context.TODO(), client.ObjectKey{Namespace: pulp.oldSubscriptionNamespace, Name: pulp.oldSubscriptionName}, &operatorsv1alpha1.Subscription{})
+	if err == nil {
+		return nil
+	} else if !isMissing(err) {
+		fmt.Println("❌ Failed to retrieve Subscription:", err)
+		return fmt.Errorf("failed to get subscription %s: %w", pulp.oldSubscriptionName, err)
+	}
+
+	deployment, err := findAnsibleOperator(c, pulp.oldSubscriptionNamespace, pulp.oldSubscriptionName)
+	if err != nil {
+		fmt.Println("❌ Failed to find the ansible operator deployment:", err)
+		return err
+	}
+	// getCurrentCSV reports the missing subscription
+	if deployment == nil {
+		return nil
+	}
+	fmt.Println("⚠️  Subscription", pulp.oldSubscriptionName, "not found, migrator will remove the ansible operator deployed without OLM:", deployment.Name)
+	pulp.withoutOLM = true
+	return nil
+}
+
+// getAnsibleOperator records the controller Deployment of the ansible operator
+// deployed without OLM, its ServiceAccount and the Roles bound only to it
+func (pulp pulp) getAnsibleOperator(c cluster) error {
+	fmt.Println("🔎 Retrieving the ansible operator deployed without OLM ...")
+	deployment, err := findAnsibleOperator(c, pulp.oldSubscriptionNamespace, pulp.oldSubscriptionName)
+	if err != nil {
+		fmt.Println("❌ Failed to find the ansible operator deployment:", err)
+		return err
+	}
+	if deployment == nil {
+		fmt.Println("❌ Failed to find the ansible operator deployment")
+		return fmt.Errorf("%s controller deployment not found in %s namespace", pulp.oldSubscriptionName, pulp.oldSubscriptionNamespace)
+	}
+	operator := &ansibleOperator{Deployment: deployment}
+	fmt.Println("Migrator will delete the following operator deployment:", deployment.Name)
+
+	// the default ServiceAccount is shared with the other pods of the namespace
+	serviceAccount := deployment.Spec.Template.Spec.ServiceAccountName
+	if serviceAccount == "" || serviceAccount == "default" {
+		pulp.original.AnsibleOperator = operator
+		return nil
+	}
+	sa := &corev1.ServiceAccount{}
+	err = c.Get(context.TODO(), client.ObjectKey{Namespace: pulp.oldSubscriptionNamespace, Name: serviceAccount}, sa)
+	if err == nil {
+		operator.ServiceAccount = sa
+		fmt.Println("Migrator will delete the following operator ServiceAccount:", sa.Name)
+	} else if !apierrors.IsNotFound(err) {
+		fmt.Println("❌ Failed to retrieve the operator ServiceAccount:", err)
+		return fmt.Errorf("failed to get serviceaccount %s: %w", serviceAccount, err)
+	}
+
+	bindingList := &rbacv1.RoleBindingList{}
+	if err := c.List(context.TODO(), bindingList, client.InNamespace(pulp.oldSubscriptionNamespace)); err != nil {
+		fmt.Println("❌ Failed to list RoleBindings:", err)
+		return fmt.Errorf("failed to list rolebindings: %w", err)
+	}
+	for _, binding := range bindingList.Items {
+		if !bindsOnly(binding, serviceAccount, pulp.oldSubscriptionNamespace) {
+			continue
+		}
+		operator.RoleBindings = append(operator.RoleBindings, binding)
+		fmt.Println("Migrator will delete the following operator RoleBinding:", binding.Name)
+
+		// the ClusterRoles are not in the namespace, so they are kept
+		if binding.RoleRef.Kind != "Role" || operator.hasRole(binding.RoleRef.Name) {
+			continue
+		}
+		role := &rbacv1.Role{}
+		err := c.Get(context.TODO(), client.ObjectKey{Namespace: pulp.oldSubscriptionNamespace, Name: binding.RoleRef.Name}, role)
+		if apierrors.IsNotFound(err) {
+			continue
+		} else if err != nil {
+			fmt.Println("❌ Failed to retrieve the operator Role:", err)
+			return fmt.Errorf("failed to get role %s: %w", binding.RoleRef.Name, err)
+		}
+		operator.Roles = append(operator.Roles, *role)
+		fmt.Println("Migrator will delete the following operator Role:", role.Name)
+	}
+
+	pulp.original.AnsibleOperator = operator
+	return nil
+}
+
+// bindsOnly returns true if every subject of the binding is the ServiceAccount
+func bindsOnly(binding rbacv1.RoleBinding, serviceAccount, namespace string) bool {
+	for _, subject := range binding.Subjects {
+		if subject.Kind != rbacv1.ServiceAccountKind || subject.Name != serviceAccount || (subject.Namespace != "" && subject.Namespace != namespace) {
+			return false
+		}
+	}
+	return len(binding.Subjects) > 0
+}
+
+// hasRole returns true if the Role was already recorded
+func (operator ansibleOperator) hasRole(name string) bool {
+	for _, role := range operator.Roles {
+		if role.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// deleteAnsibleOperator removes the ansible operator deployed without OLM,
+// so it stops reconciling the ansible Pulp CR
+func (pulp pulp) deleteAnsibleOperator(c cluster) error {
+	pulp.original.AnsibleOperatorDeleted = true
+	objs := pulp.original.AnsibleOperator.manifests()
+
+	// the controller goes first, so it does not run without permissions
+	for i := len(objs) - 1; i >= 0; i-- {
+		fmt.Println("🗑️  Deleting", describe(c, objs[i]), "...")
+		err := pulp.delete(c, objs[i])
+		if apierrors.IsNotFound(err) {
+			fmt.Println("⏭️ ", describe(c, objs[i]), "was already deleted")
+		} else if err != nil {
+			fmt.Println("❌ Failed to delete the ansible operator:", err)
+			return fmt.Errorf("failed to delete %s: %w", describe(c, objs[i]), err)
+		}
+	}
+	return nil
+}
+
+// restoreAnsibleOperator recreates the resources removed by deleteAnsibleOperator
+func (pulp pulp) restoreAnsibleOperator(c cluster) error {
+	for _, obj := range pulp.original.AnsibleOperator.manifests() {
+		fmt.Println("Recreating", describe(c, obj), "...")
+		if err := pulp.create(c, obj); err != nil && !apierrors.IsAlreadyExists(err) {
+			return fmt.Errorf("failed to recreate %s: %w", describe(c, obj), err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"migrator/conversion"
+
+	repomanagerv1alpha1 "github.com/pulp/pulp-operator/api/v1alpha1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// ansibleBackup is an ansible PulpBackup (or GalaxyBackup) CR
+type ansibleBackup struct {
+	Metadata metav1.ObjectMeta              `json:"metadata"`
+	Spec     conversion.AnsibleBackupSpec   `json:"spec"`
+	Status   conversion.AnsibleBackupStatus `json:"status"`
+}
+
+// ansibleRestore is an ansible PulpRestore (or GalaxyRestore) CR
+type ansibleRestore struct {
+	Metadata metav1.ObjectMeta               `json:"metadata"`
+	Spec     conversion.AnsibleRestoreSpec   `json:"spec"`
+	Status   conversion.AnsibleRestoreStatus `json:"status"`
+}
+
+// convertBackups creates a golang PulpBackup CR for each ansible backup CR of
+// the migrated instance, and a golang PulpRestore CR for each unfinished
+// restore if convertRestores is set.
+// The golang Pulp CR was already created, so a failure here does not revert
+// the migration, the failed CRs are reported to be converted manually.
+func (pulp pulp) convertBackups(c cluster) error {
+	fmt.Println("🔎 Retrieving the ansible backups and restores ...")
+	if err := (&pulp).getAnsibleCR(c); err != nil {
+		return err
+	}
+	pulpNew, _ := pulp.toGolang(pulp.convertSpec(), "")
+
+	failed := []string{}
+	backups := []ansibleBackup{}
+	if err := pulp.listAnsible(c, "Backup", &backups); err != nil {
+		fmt.Println("⚠️  Failed to list the ansible backups, they should be converted manually:", err)
+	}
+	backupStatus := map[string]*conversion.AnsibleBackupStatus{}
+	for i, backup := range backups {
+		backupStatus[backup.Metadata.Name] = &backups[i].Status
+		if backup.Spec.DeploymentName != pulp.oldResourceName {
+			continue
+		}
+		// the golang operator would run a new backup for it
+		if _, ok := backup.Metadata.Annotations[backupAnnotation]; ok {
+			fmt.Println("⏭️  Skipping", backup.Metadata.Name, "backup (pre-migration backup)")
+			continue
+		}
+		spec, warnings := conversion.ConvertBackup(backup.Spec, backup.Status, pulpNew)
+		if err := pulp.createGolang(c, "Backup", backup.Metadata.Name, spec, warnings); err != nil {
+			failed = append(failed, pulp.newKind+"Backup "+backup.Metadata.Name)
+		}
+	}
+
+	restores := []ansibleRestore{}
+	if err := pulp.listAnsible(c, "Restore", &restores); err != nil {
+		fmt.Println("⚠️  Failed to list the ansible restores, they should be converted manually:", err)
+	}
+	for _, restore := range restores {
+		if restore.Spec.DeploymentName != pulp.oldResourceName {
+			continue
+		}
+		// a new restore would overwrite the data of the migrated instance
+		if !pulp.convertRestores {
+			fmt.Println("⏭️  Skipping", restore.Metadata.Name, "restore (CONVERT_RESTORES is not set)")
+			continue
+		}
+		if restore.Status.Completed() {
+			fmt.Println("⏭️  Skipping", restore.Metadata.Name, "restore (already completed)")
+			continue
+		}
+		fmt.Println("⚠️  The golang operator will run", restore.Metadata.Name, "restore right away, overwriting the data of", pulp.newResourceName)
+		spec, warnings := conversion.ConvertRestore(restore.Spec, backupStatus[restore.Spec.BackupName], pulpNew)
+		if err := pulp.createGolang(c, "Restore", restore.Metadata.Name, spec, warnings); err != nil {
+			failed = append(failed, pulp.newKind+"Restore "+restore.Metadata.Name)
+		}
+	}
+
+	if len(failed) > 0 {
+		fmt.Println("⚠️  The following CRs were not converted and should be created manually:", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// listAnsible retrieves the ansible CRs of the given kind suffix (Backup or
+// Restore) in the namespace of the ansible Pulp CR.
+// The CRD is optional, so nothing is returned if it is not found.
+func (pulp pulp) listAnsible(c cluster, suffix string, items any) error {
+	list := newUnstructuredList(pulp.oldApi, pulp.Kind+suffix)
+	err := c.List(context.TODO(), list, client.InNamespace(pulp.oldSubscriptionNamespace))
+	if isMissing(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to list %s CRs: %w", pulp.Kind+suffix, err)
+	}
+	if err := fromUnstructured(list.UnstructuredContent()["items"], items); err != nil {
+		return fmt.Errorf("failed to read %s CRs: %w", pulp.Kind+suffix, err)
+	}
+	return nil
+}
+
+// createGolang creates the golang CR of the given kind suffix (Backup or
+// Restore) with the converted spec
+func (pulp pulp) createGolang(c cluster, suffix, name string, spec any, warnings []string) error {
+	kind := pulp.newKind + suffix
+	fmt.Println("Converting", name, "to a", kind, "CR ...")
+	for _, warning := range warnings {
+		fmt.Println("⚠️ ", warning)
+	}
+
+	var obj any
+	meta := metav1.ObjectMeta{Name: name, Namespace: pulp.newSubscriptionNamespace}
+	typeMeta := metav1.TypeMeta{APIVersion: pulp.newApi, Kind: kind}
+	switch spec := spec.(type) {
+	case repomanagerv1alpha1.PulpBackupSpec:
+		obj = repomanagerv1alpha1.PulpBackup{TypeMeta: typeMeta, ObjectMeta: meta, Spec: spec}
+	case repomanagerv1alpha1.PulpRestoreSpec:
+		obj = repomanagerv1alpha1.PulpRestore{TypeMeta: typeMeta, ObjectMeta: meta, Spec: spec}
+	}
+	cr, err := toUnstructured(obj)
+	if err != nil {
+		fmt.Println("❌ Failed to serialize new "+kind+" CR:", err)
+		return err
+	}
+
+	// same as the Pulp CR, in dry-run mode the golang CRDs could be missing
+	if pulp.dryRun {
+		if installed, err := pulp.golangCRDInstalled(c, kind); err != nil || !installed {
+			body, err := cr.MarshalJSON()
+			if err != nil {
+				return err
+			}
+			pulp.printPlan("POST", requestPath(c, cr, cr.GetNamespace(), ""), body)
+			return nil
+		}
+	}
+	if err := pulp.create(c, cr); apierrors.IsAlreadyExists(err) {
+		fmt.Println("⏭️ ", kind, name, "already exists")
+	} else if err != nil {
+		fmt.Println("❌ Failed to create new "+kind+" CR:", err)
+		return fmt.Errorf("failed to create %s %s: %w", kind, name, err)
+	}
+	return nil
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	operatorsv1alpha1 "github.com/operator-framework/api/pkg/operators/v1alpha1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// batchInstance is an ansible Pulp CR found by the batch mode
+type batchInstance struct {
+	namespace    string
+	name         string
+	subscription string
+	err          error
+	done         bool
+}
+
+// runBatch migrates every ansible Pulp CR found in the cluster (or in a list
+// of namespaces), one after the other
+func runBatch(args []string) error {
+	flags, opts := newFlagSet("batch")
+	opts.batch = true
+	flags.BoolVar(&opts.conversionOnly, "conversion-only", opts.conversionOnly, "only create the golang Pulp CRs (CONVERSION_ONLY)")
+	namespaces := flags.String("namespaces", os.Getenv("BATCH_NAMESPACES"), "comma separated list of namespaces to look for ansible Pulp CRs, all of them if not provided (BATCH_NAMESPACES)")
+	selector := flags.String("selector", os.Getenv("BATCH_SELECTOR"), "label selector of the ansible Pulp CRs to migrate (BATCH_SELECTOR)")
+	continueOnError := flags.Bool("continue-on-error", envBool("BATCH_CONTINUE_ON_ERROR", true), "keep migrating the other Pulp CRs when one of them fails (BATCH_CONTINUE_ON_ERROR)")
+	c, err := parse(flags, opts, args)
+	if err != nil {
+		return err
+	}
+	if opts.dryRun {
+		fmt.Println("📝 Running in dry-run mode, no changes will be made to the cluster")
+	}
+	return migrateBatch(c, opts, *namespaces, *selector, *continueOnError)
+}
+
+// migrateBatch migrates the ansible Pulp CRs of the namespaces matching the
+// selector and prints the result of each migration
+func migrateBatch(c cluster, opts *options, namespaces, selector string, continueOnError bool) error {
+	instances, err := listAnsibleCRs(c, opts, namespaces, selector)
+	if err != nil {
+		return err
+	}
+	if len(instances) == 0 {
+		fmt.Println("No ansible Pulp CR found")
+		return nil
+	}
+
+	// the Pulp CRs sharing a subscription are migrated together: only the
+	// first one replaces the subscription
+	migratedSubscriptions := map[string]bool{}
+	for i := range instances {
+		instance := &instances[i]
+		if instance.err != nil {
+			continue
+		}
+		fmt.Printf("\n🔁 Migrating %s/%s (subscription %s) ...\n", instance.namespace, instance.name, instance.subscription)
+
+		instanceOpts := *opts
+		instanceOpts.namespace = instance.namespace
+		instanceOpts.resourceName = instance.name
+		instanceOpts.newResourceName = instance.name
+		instanceOpts.subscriptionName = instance.subscription
+		if instanceOpts.newSubscriptionName == "" {
+			instanceOpts.newSubscriptionName = instance.subscription
+		}
+		pulp := instanceOpts.newPulp()
+		group := instance.namespace + "/" + instance.subscription
+		pulp.sharedSubscription = migratedSubscriptions[group]
+
+		instance.err = pulp.migrate(c, &instanceOpts)
+		instance.done = true
+		if instance.err == nil {
+			migratedSubscriptions[group] = true
+		} else if !continueOnError {
+			break
+		}
+	}
+
+	return printBatchSummary(instances)
+}
+
+// listAnsibleCRs returns the ansible Pulp CRs to be migrated, with the
+// subscription of the operator managing each of them
+func listAnsibleCRs(c cluster, opts *options, namespaces, selector string) ([]batchInstance, error) {
+	// an empty namespace lists the CRs of every namespace
+	namespaceList := []string{""}
+	if namespaces != "" {
+		namespaceList = []string{}
+		for _, namespace := range strings.Split(namespaces, ",") {
+			namespaceList = append(namespaceList, strings.TrimSpace(namespace))
+		}
+	}
+	labelSelector, err := labels.Parse(selector)
+	if err != nil {
+		fmt.Println("❌ Invalid label selector:", err)
+		return nil, fmt.Errorf("invalid label selector %q: %w", selector, err)
+	}
+	kind, err := kindFor(c, opts.api, opts.resource)
+	if err != nil {
+		fmt.Println("❌ Failed to find the "+opts.resource+" resource in "+opts.api+":", err)
+		return nil, fmt.Errorf("failed to find the %s resource in %s: %w", opts.resource, opts.api, err)
+	}
+
+	fmt.Println("🔎 Retrieving the ansible Pulp CRs ...")
+	instances := []batchInstance{}
+	subscriptions := map[string]string{}
+	for _, namespace := range namespaceList {
+		list := newUnstructuredList(opts.api, kind)
+		if err := c.List(context.TODO(), list, client.InNamespace(namespace), client.MatchingLabelsSelector{Selector: labelSelector}); err != nil {
+			fmt.Println("❌ Failed to list ansible Pulp CRs:", err)
+			return nil, fmt.Errorf("failed to list %s: %w", opts.resource, err)
+		}
+
+		for _, item := range list.Items {
+			instance := batchInstance{namespace: item.GetNamespace(), name: item.GetName()}
+			subscription, found := subscriptions[instance.namespace]
+			if !found {
+				subscription, err = findSubscription(c, opts, instance.namespace)
+				if err != nil {
+					instance.err = err
+				}
+				subscriptions[instance.namespace] = subscription
+			}
+			instance.subscription = subscription
+			if subscription == "" && instance.err == nil {
+				instance.subscription, instance.err = findAnsibleOperatorName(c, opts, instance.namespace)
+				subscriptions[instance.namespace] = instance.subscription
+			}
+			if instance.subscription == "" && instance.err == nil {
+				instance.err = fmt.Errorf("no ansible Pulp Operator subscription found in %s namespace", instance.namespace)
+			}
+			instances = append(instances, instance)
+		}
+	}
+	return instances, nil
+}
+
+// findSubscription returns the name of the ansible Pulp Operator subscription
+// in the namespace: the one named after -subscription or, if not found, the
+// one subscribed to the package with the same name
+func findSubscription(c cluster, opts *options, namespace string) (string, error) {
+	err := c.Get(context.TODO(), client.ObjectKey{Namespace: namespace, Name: opts.subscriptionName}, &operatorsv1alpha1.Subscription{})
+	if err == nil {
+		return opts.subscriptionName, nil
+	} else if meta.IsNoMatchError(err) {
+		// OLM is not installed
+		return "", nil
+	} else if !apierrors.IsNotFound(err) {
+		return "", fmt.Errorf("failed to get subscription %s: %w", opts.subscriptionName, err)
+	}
+
+	subList := &operatorsv1alpha1.SubscriptionList{}
+	if err := c.List(context.TODO(), subList, client.InNamespace(namespace)); err != nil {
+		return "", fmt.Errorf("failed to list subscriptions: %w", err)
+	}
+	for _, sub := range subList.Items {
+		if sub.Spec != nil && sub.Spec.Package == opts.subscriptionName {
+			return sub.Name, nil
+		}
+	}
+	return "", nil
+}
+
+// findAnsibleOperatorName returns the name of the ansible Pulp Operator
+// deployed without OLM in the namespace (-subscription), if its controller
+// Deployment is found
+func findAnsibleOperatorName(c cluster, opts *options, namespace string) (string, error) {
+	deployment, err := findAnsibleOperator(c, namespace, opts.subscriptionName)
+	if err != nil || deployment == nil {
+		return "", err
+	}
+	return opts.subscriptionName, nil
+}
+
+// printBatchSummary prints the result of each migration and returns an
+// error if any of them failed
+func printBatchSummary(instances []batchInstance) error {
+	fmt.Println("\n📋 Batch migration summary:")
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAMESPACE\tNAME\tSUBSCRIPTION\tRESULT")
+	failed := 0
+	for _, instance := range instances {
+		result := "✅ migrated"
+		switch {
+		case instance.err != nil:
+			result = "❌ " + instance.err.Error()
+			failed++
+		case !instance.done:
+			result = "⏭️  skipped"
+			failed++
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", instance.namespace, instance.name, instance.subscription, result)
+	}
+	w.Flush()
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d Pulp CRs were not migrated", failed, len(instances))
+	}
+	return nil
+}
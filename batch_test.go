@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	operatorsv1alpha1 "github.com/operator-framework/api/pkg/operators/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// batchInstall returns three Pulp CRs managed by the same ansible operator,
+// the second one failing its last reconciliation
+func batchInstall() []client.Object {
+	objs := append(ansibleInstall(), ansibleInstance("example-pulp-2")...)
+	objs = append(objs, ansibleInstance("example-pulp-3")...)
+	for _, obj := range objs {
+		if cr, ok := obj.(*unstructured.Unstructured); ok && cr.GetName() == "example-pulp-2" {
+			cr.Object["status"] = map[string]any{
+				"conditions": []any{map[string]any{"type": "Failure", "status": "True", "message": "failed to deploy"}},
+			}
+		}
+	}
+	return objs
+}
+
+// batchOptions returns the options of a batch migration
+func batchOptions(t *testing.T) *options {
+	flags, opts := newFlagSet("batch")
+	opts.batch = true
+	if err := flags.Parse([]string{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := opts.validate(); err != nil {
+		t.Fatal(err)
+	}
+	return opts
+}
+
+// assertInstance verifies whether the Pulp CR with the given name was handed
+// over to the golang operator or left running with the ansible one
+func assertInstance(t *testing.T, c cluster, opts *options, name string, migrated bool) {
+	t.Helper()
+	cr := newUnstructured(opts.newApi, opts.newKind)
+	sts := &appsv1.StatefulSet{}
+	get(t, c, testNamespace, name+"-postgres-13", sts)
+	if !migrated {
+		assertNotFound(t, c, testNamespace, name, cr)
+		if *sts.Spec.Replicas != 1 {
+			t.Errorf("%s database statefulset replicas = %d, expected 1", name, *sts.Spec.Replicas)
+		}
+		for deployment := range ansibleDeployments(name) {
+			get(t, c, testNamespace, deployment, &appsv1.Deployment{})
+		}
+		return
+	}
+
+	get(t, c, testNamespace, name, cr)
+	if *sts.Spec.Replicas != 0 {
+		t.Errorf("%s database statefulset replicas = %d, expected 0", name, *sts.Spec.Replicas)
+	}
+	// the golang operator deployments have the same names as the ansible ones
+	for deployment := range ansibleDeployments(name) {
+		d := &appsv1.Deployment{}
+		err := c.Get(context.TODO(), client.ObjectKey{Namespace: testNamespace, Name: deployment}, d)
+		if err == nil && d.Labels["app.kubernetes.io/managed-by"] == "pulp-operator" {
+			t.Errorf("found ansible deployment %s, expected it to be deleted", deployment)
+		} else if err != nil && !apierrors.IsNotFound(err) {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestMigrateBatch(t *testing.T) {
+	tests := []struct {
+		name            string
+		continueOnError bool
+		err             string
+		migrated        []string
+		unchanged       []string
+	}{
+		{"continue on error", true, "1 of 3 Pulp CRs were not migrated", []string{"example-pulp", "example-pulp-3"}, []string{"example-pulp-2"}},
+		{"stop on error", false, "2 of 3 Pulp CRs were not migrated", []string{"example-pulp"}, []string{"example-pulp-2", "example-pulp-3"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newFakeCluster(batchInstall()...)
+			opts := batchOptions(t)
+			err := migrateBatch(c, opts, testNamespace, "", tt.continueOnError)
+			if err == nil || err.Error() != tt.err {
+				t.Fatalf("migrateBatch() = %v, expected %q", err, tt.err)
+			}
+			for _, name := range tt.migrated {
+				assertInstance(t, c, opts, name, true)
+			}
+			for _, name := range tt.unchanged {
+				assertInstance(t, c, opts, name, false)
+			}
+
+			// the first migration replaced the subscription shared by the
+			// Pulp CRs, the other ones kept it
+			sub := &operatorsv1alpha1.Subscription{}
+			get(t, c, testNamespace, "pulp-operator", sub)
+			if !strings.HasPrefix(sub.Spec.StartingCSV, "pulp-operator.v1") {
+				t.Errorf("subscription startingCSV = %q, expected the golang operator", sub.Spec.StartingCSV)
+			}
+		})
+	}
+}
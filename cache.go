@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"migrator/conversion"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// detectExternalCache checks if the ansible Pulp CR points to a Redis not
+// deployed by the operator (redis_url or redis_host in pulp_settings).
+// In this case there is no redis PVC to migrate.
+func (pulp *pulp) detectExternalCache() error {
+	_, found, err := conversion.ExternalCacheSecretData(pulp.Spec.PulpSettings)
+	if err != nil {
+		fmt.Println("❌ Failed to read the redis settings:", err)
+		return err
+	}
+	pulp.externalCache = found
+	if pulp.externalCache {
+		fmt.Println("Migrator will keep using the external Redis, no redis pod will be migrated")
+	}
+	return nil
+}
+
+// getCurrentRedisPVC checks if the PVC provisioned by the ansible operator
+// for the redis pod exists
+func (pulp *pulp) getCurrentRedisPVC(c cluster) error {
+	fmt.Println("🔎 Retrieving the current Redis PVC ...")
+	redisPVC := pulp.oldResourceName + "-redis-data"
+	err := c.Get(context.TODO(), client.ObjectKey{Namespace: pulp.oldSubscriptionNamespace, Name: redisPVC}, &corev1.PersistentVolumeClaim{})
+	if apierrors.IsNotFound(err) {
+		fmt.Println("⚠️  Redis PVC", redisPVC, "not found, golang operator will provision a new one")
+		return nil
+	} else if err != nil {
+		fmt.Println("❌ Failed to find Redis PVC:", err)
+		return fmt.Errorf("failed to get PVC %s: %w", redisPVC, err)
+	}
+
+	pulp.oldRedisPVC = redisPVC
+	fmt.Println("Migrator will use the following PVC to the redis pod:", redisPVC)
+	return nil
+}
+
+// externalCacheSecretName returns the name of the secret created with the
+// external Redis credentials in the golang operator format
+func (pulp pulp) externalCacheSecretName() string {
+	return pulp.newResourceName + "-external-cache"
+}
+
+// createExternalCacheSecret stores the external Redis settings from
+// pulp_settings in the format expected by cache.external_cache_secret
+func (pulp *pulp) createExternalCacheSecret(c cluster) error {
+	fmt.Println("Creating", pulp.externalCacheSecretName(), "secret with the external Redis settings ...")
+	data, _, err := conversion.ExternalCacheSecretData(pulp.Spec.PulpSettings)
+	if err != nil {
+		fmt.Println("❌ Failed to read the redis settings:", err)
+		return err
+	}
+
+	secret := &corev1.Secret{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "v1",
+			Kind:       "Secret",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      pulp.externalCacheSecretName(),
+			Namespace: pulp.newSubscriptionNamespace,
+			Labels: map[string]string{
+				"app.kubernetes.io/managed-by": "pulp-migrator",
+			},
+		},
+		Data: data,
+	}
+	err = pulp.create(c, secret)
+	if err != nil && !apierrors.IsAlreadyExists(err) {
+		fmt.Println("❌ Failed to create "+secret.Name+" secret:", err)
+		return fmt.Errorf("failed to create secret %s: %w", secret.Name, err)
+	}
+	if err == nil {
+		pulp.original.ExternalCacheSecretCreated = true
+	}
+	pulp.externalCacheSecret = secret.Name
+	return nil
+}
+
+// deleteExternalCacheSecret removes the secret created by createExternalCacheSecret
+func (pulp pulp) deleteExternalCacheSecret(c cluster) error {
+	err := pulp.delete(c, &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: pulp.externalCacheSecretName(), Namespace: pulp.newSubscriptionNamespace}})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete secret %s: %w", pulp.externalCacheSecretName(), err)
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	operatorsv1alpha1 "github.com/operator-framework/api/pkg/operators/v1alpha1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// catalogSourceReady is the GRPC connection state of a CatalogSource whose
+// registry pod is serving the index image
+const catalogSourceReady = "READY"
+
+// newCatalogSource returns the CatalogSource created from indexImage
+func (pulp pulp) newCatalogSource() *operatorsv1alpha1.CatalogSource {
+	return &operatorsv1alpha1.CatalogSource{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      pulp.newSubscriptionSource,
+			Namespace: pulp.newSubscriptionSourceNamespace,
+		},
+		Spec: operatorsv1alpha1.CatalogSourceSpec{
+			SourceType:  operatorsv1alpha1.SourceTypeGrpc,
+			Image:       pulp.indexImage,
+			DisplayName: "Pulp Operator",
+		},
+	}
+}
+
+// getCatalogSource retrieves the CatalogSource of the golang operator
+func (pulp pulp) getCatalogSource(c cluster) (*operatorsv1alpha1.CatalogSource, error) {
+	catalog := &operatorsv1alpha1.CatalogSource{}
+	err := c.Get(context.TODO(), client.ObjectKey{Namespace: pulp.newSubscriptionSourceNamespace, Name: pulp.newSubscriptionSource}, catalog)
+	return catalog, err
+}
+
+// checkIndexImage verifies that the CatalogSource does not exist yet, or
+// that it serves indexImage so it can be reused
+func (pulp pulp) checkIndexImage(c cluster) error {
+	catalog, err := pulp.getCatalogSource(c)
+	if apierrors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to get the catalogsource: %w", err)
+	}
+	if catalog.Spec.Image != pulp.indexImage {
+		return fmt.Errorf("catalogsource already exists with %q image", catalog.Spec.Image)
+	}
+	return nil
+}
+
+// createCatalogSource creates the CatalogSource of the golang operator from
+// indexImage, an existing one is reused if it serves the same image
+func (pulp pulp) createCatalogSource(c cluster) error {
+	fmt.Println("🔎 Retrieving", pulp.newSubscriptionSource, "CatalogSource ...")
+	catalog, err := pulp.getCatalogSource(c)
+	if err == nil {
+		if catalog.Spec.Image != pulp.indexImage {
+			fmt.Println("❌ CatalogSource", pulp.newSubscriptionSource, "already exists with", catalog.Spec.Image, "image")
+			return fmt.Errorf("catalogsource %s already exists with %q image", pulp.newSubscriptionSource, catalog.Spec.Image)
+		}
+		fmt.Println("⏭️  CatalogSource", pulp.newSubscriptionSource, "already serves", pulp.indexImage)
+		return nil
+	} else if !apierrors.IsNotFound(err) {
+		fmt.Println("❌ Failed to retrieve CatalogSource:", err)
+		return fmt.Errorf("failed to get catalogsource %s: %w", pulp.newSubscriptionSource, err)
+	}
+
+	fmt.Println("Creating", pulp.newSubscriptionSource, "CatalogSource from", pulp.indexImage, "...")
+	if err := pulp.create(c, pulp.newCatalogSource()); err != nil {
+		fmt.Println("❌ Failed to create CatalogSource:", err)
+		return fmt.Errorf("failed to create catalogsource %s: %w", pulp.newSubscriptionSource, err)
+	}
+	pulp.original.CatalogSourceCreated = true
+	return nil
+}
+
+// waitForCatalogSource waits for the registry of the CatalogSource to be
+// reachable and for its PackageManifest to provide the starting CSV
+func (pulp pulp) waitForCatalogSource(c cluster) error {
+	// nothing was created in dry-run mode
+	if pulp.dryRun {
+		fmt.Println("📝 [dry-run] Waiting for", pulp.newSubscriptionSource, "CatalogSource to provide", pulp.newSubscriptionStartingCSV)
+		return nil
+	}
+
+	fmt.Println("Waiting for", pulp.newSubscriptionSource, "CatalogSource to provide", pulp.newSubscriptionStartingCSV, "...")
+	var notReady error
+	err := waitFor(pulp.operatorTimeout, func() (bool, error) {
+		catalog, err := pulp.getCatalogSource(c)
+		if err != nil {
+			return false, fmt.Errorf("failed to get catalogsource %s: %w", pulp.newSubscriptionSource, err)
+		}
+		state := catalog.Status.GRPCConnectionState
+		if state == nil || state.LastObservedState != catalogSourceReady {
+			notReady = fmt.Errorf("connection state is not %s", catalogSourceReady)
+			return false, nil
+		}
+		if err := pulp.checkPackage(c); err != nil {
+			notReady = err
+			return false, nil
+		}
+		return true, nil
+	})
+	if err != nil {
+		if notReady != nil {
+			err = fmt.Errorf("%w, %v", err, notReady)
+		}
+		fmt.Println("❌ The CatalogSource is not ready:", err)
+		return err
+	}
+	fmt.Println("✅ CatalogSource", pulp.newSubscriptionSource, "ready")
+	return nil
+}
+
+// deleteCatalogSource removes the CatalogSource created by createCatalogSource
+func (pulp pulp) deleteCatalogSource(c cluster) error {
+	err := pulp.delete(c, pulp.newCatalogSource())
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete catalogsource %s: %w", pulp.newSubscriptionSource, err)
+	}
+	return nil
+}
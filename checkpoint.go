@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// migrationStep is one of the steps run by the migrator.
+// The name is used to record its completion in the checkpoint.
+type migrationStep struct {
+	name string
+	run  func() error
+}
+
+// checkpoint keeps track of the migration progress.
+// It is persisted in a ConfigMap so a re-run can skip the steps that
+// were already completed and reuse the values discovered by them.
+type checkpoint struct {
+	completedSteps []string
+
+	// if the ConfigMap was already created
+	exists bool
+}
+
+// checkpointName returns the name of the ConfigMap that stores the migration progress
+func (pulp pulp) checkpointName() string {
+	return pulp.oldResourceName + "-migrator-state"
+}
+
+// completed returns true if the step was already done in a previous run
+func (c *checkpoint) completed(step string) bool {
+	for _, s := range c.completedSteps {
+		if s == step {
+			return true
+		}
+	}
+	return false
+}
+
+// loadCheckpoint retrieves the progress of a previous run (if any)
+// and restores the values discovered by it
+func (pulp *pulp) loadCheckpoint(c cluster) error {
+	pulp.checkpoint = &checkpoint{}
+	if pulp.skipCheckpoint {
+		return nil
+	}
+	cm := &corev1.ConfigMap{}
+	err := c.Get(context.TODO(), client.ObjectKey{Namespace: pulp.oldSubscriptionNamespace, Name: pulp.checkpointName()}, cm)
+	if apierrors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		fmt.Println("❌ Failed to retrieve the migration state:", err)
+		return fmt.Errorf("failed to get configmap %s: %w", pulp.checkpointName(), err)
+	}
+
+	if original := cm.Data["original"]; original != "" {
+		if err := json.Unmarshal([]byte(original), pulp.original); err != nil {
+			fmt.Println("❌ Failed to read the migration state:", err)
+			return fmt.Errorf("failed to read configmap %s: %w", pulp.checkpointName(), err)
+		}
+	}
+
+	pulp.checkpoint.exists = true
+	if steps := cm.Data["completedSteps"]; steps != "" {
+		pulp.checkpoint.completedSteps = strings.Split(steps, ",")
+	}
+	pulp.oldDBPVC = cm.Data["oldDBPVC"]
+	pulp.oldDBSVC = cm.Data["oldDBSVC"]
+	pulp.oldDBSts = cm.Data["oldDBSts"]
+	pulp.externalDBSecret = cm.Data["externalDBSecret"]
+	pulp.oldRedisPVC = cm.Data["oldRedisPVC"]
+	pulp.externalCacheSecret = cm.Data["externalCacheSecret"]
+
+	fmt.Println("🔁 Resuming migration from", pulp.checkpointName(), "ConfigMap, completed steps:", cm.Data["completedSteps"])
+	return nil
+}
+
+// saveCheckpoint records the completion of a step together with the
+// values discovered so far
+func (pulp pulp) saveCheckpoint(c cluster, step string) error {
+	// dry-run does not change anything, so there is nothing to resume from
+	if pulp.dryRun || pulp.skipCheckpoint {
+		return nil
+	}
+
+	pulp.checkpoint.completedSteps = append(pulp.checkpoint.completedSteps, step)
+	original, err := json.Marshal(pulp.original)
+	if err != nil {
+		fmt.Println("❌ Failed to serialize the migration state:", err)
+		return err
+	}
+
+	cm := &corev1.ConfigMap{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "v1",
+			Kind:       "ConfigMap",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      pulp.checkpointName(),
+			Namespace: pulp.oldSubscriptionNamespace,
+			Labels: map[string]string{
+				"app.kubernetes.io/managed-by": "pulp-migrator",
+			},
+		},
+		Data: map[string]string{
+			"completedSteps":      strings.Join(pulp.checkpoint.completedSteps, ","),
+			"oldDBPVC":            pulp.oldDBPVC,
+			"oldDBSVC":            pulp.oldDBSVC,
+			"oldDBSts":            pulp.oldDBSts,
+			"externalDBSecret":    pulp.externalDBSecret,
+			"oldRedisPVC":         pulp.oldRedisPVC,
+			"externalCacheSecret": pulp.externalCacheSecret,
+			"original":            string(original),
+		},
+	}
+	if pulp.checkpoint.exists {
+		err = c.Update(context.TODO(), cm)
+	} else {
+		err = c.Create(context.TODO(), cm)
+	}
+	if err != nil {
+		fmt.Println("❌ Failed to save the migration state:", err)
+		return fmt.Errorf("failed to save configmap %s: %w", pulp.checkpointName(), err)
+	}
+	pulp.checkpoint.exists = true
+	return nil
+}
+
+// deleteCheckpoint removes the migration progress, so the next run starts from scratch
+func (pulp pulp) deleteCheckpoint(c cluster) error {
+	if pulp.dryRun || !pulp.checkpoint.exists {
+		return nil
+	}
+	err := c.Delete(context.TODO(), &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: pulp.checkpointName(), Namespace: pulp.oldSubscriptionNamespace}})
+	if err != nil && !apierrors.IsNotFound(err) {
+		fmt.Println("❌ Failed to remove the migration state:", err)
+		return fmt.Errorf("failed to delete configmap %s: %w", pulp.checkpointName(), err)
+	}
+	pulp.checkpoint.exists = false
+	return nil
+}
+
+// runSteps runs each step not completed in a previous run, recording its completion
+func (pulp *pulp) runSteps(c cluster, steps []migrationStep) error {
+	for _, step := range steps {
+		if pulp.checkpoint.completed(step.name) {
+			fmt.Println("⏭️  Skipping", step.name, "(already completed)")
+			continue
+		}
+		if err := step.run(); err != nil {
+			return err
+		}
+		if err := pulp.saveCheckpoint(c, step.name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
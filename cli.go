@@ -0,0 +1,414 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+const usage = `Usage: pulp-migrator <command> [flags]
+
+Migrates a Pulp installation from the ansible Pulp Operator to the golang Pulp Operator.
+
+Commands:
+  migrate    run the migration (default command)
+  plan       print every change the migration would make, without modifying the cluster
+  convert    create only the golang Pulp CR (or convert a manifest offline with -f)
+  rollback   restore the resources changed by an unfinished migration
+  status     show the progress of the migration
+  preflight  verify if the cluster is ready to be migrated
+  verify     verify if the migrated installation is working
+  batch      migrate every ansible Pulp CR in the cluster (or in a list of namespaces)
+
+Run "pulp-migrator <command> -h" for the flags of each command.
+Every flag falls back to the env var shown in its description.
+`
+
+// options holds the configuration of the migrator, provided through flags
+// or through the env vars used as their defaults
+type options struct {
+	// ansible operator and Pulp CR
+	namespace        string
+	resourceName     string
+	subscriptionName string
+	api              string
+	resource         string
+
+	// golang operator and Pulp CR
+	newResourceName     string
+	newSubscriptionName string
+	channel             string
+	installPlanApproval string
+	source              string
+	sourceNamespace     string
+	startingCSV         string
+	indexImage          string
+	newApi              string
+	newKind             string
+	newResource         string
+
+	// behavior
+	conversionOnly    bool
+	dryRun            bool
+	rollbackOnFailure bool
+	skipPreflight     bool
+	reportFormat      string
+	backupMethod      string
+	backupTimeout     time.Duration
+	convertRestores   bool
+
+	// golang operator installation
+	approveInstallPlan  bool
+	adjustOperatorGroup bool
+	operatorTimeout     time.Duration
+	operatorManifests   string
+
+	// post-migration verification
+	verifyTimeout time.Duration
+
+	// the Pulp CRs are found by the batch command instead of provided
+	batch bool
+}
+
+// envOr returns the value of the env var or def if it is not defined
+func envOr(name, def string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return def
+}
+
+// envBool returns the boolean value of the env var or def if it is not defined
+func envBool(name string, def bool) bool {
+	switch strings.ToLower(os.Getenv(name)) {
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+	return def
+}
+
+// envDuration returns the duration in the env var or def if it is not defined
+// (or invalid)
+func envDuration(name string, def time.Duration) time.Duration {
+	if value, err := time.ParseDuration(os.Getenv(name)); err == nil {
+		return value
+	}
+	return def
+}
+
+// newFlagSet returns a FlagSet with the flags shared by every command that
+// talks to the cluster
+func newFlagSet(name string) (*flag.FlagSet, *options) {
+	opts := &options{}
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.StringVar(&opts.namespace, "namespace", os.Getenv("PULP_NAMESPACE"), "namespace of the ansible Pulp CR (PULP_NAMESPACE)")
+	flags.StringVar(&opts.resourceName, "name", os.Getenv("PULP_RESOURCE_NAME"), "name of the ansible Pulp CR (PULP_RESOURCE_NAME)")
+	flags.StringVar(&opts.subscriptionName, "subscription", envOr("PULP_SUBSCRIPTION_NAME", "pulp-operator"), "name of the ansible Pulp Operator subscription (PULP_SUBSCRIPTION_NAME)")
+	flags.StringVar(&opts.api, "api", envOr("PULP_API", "pulp.pulpproject.org/v1beta1"), "ansible Pulp Operator APIVersion (PULP_API)")
+	flags.StringVar(&opts.resource, "resource", envOr("PULP_RESOURCE", "pulps"), "ansible Pulp Operator resource type (PULP_RESOURCE)")
+	flags.StringVar(&opts.newResourceName, "new-name", os.Getenv("NEW_PULP_RESOURCE_NAME"), "name of the golang Pulp CR, defaults to -name (NEW_PULP_RESOURCE_NAME)")
+	flags.StringVar(&opts.newSubscriptionName, "new-subscription", os.Getenv("NEW_PULP_SUBSCRIPTION_NAME"), "name of the golang Pulp Operator subscription, defaults to -subscription (NEW_PULP_SUBSCRIPTION_NAME)")
+	flags.StringVar(&opts.channel, "channel", envOr("NEW_SUBSCRIPTION_CHANNEL", "beta"), "golang Pulp Operator subscription channel (NEW_SUBSCRIPTION_CHANNEL)")
+	flags.StringVar(&opts.installPlanApproval, "install-plan-approval", envOr("NEW_SUBSCRIPTION_INSTALL_PLAN_APPROVAL", "Automatic"), "InstallPlan approval of the golang Pulp Operator subscription, Automatic or Manual (NEW_SUBSCRIPTION_INSTALL_PLAN_APPROVAL)")
+	flags.StringVar(&opts.source, "source", envOr("NEW_SUBSCRIPTION_SOURCE", "community-operators"), "CatalogSource of the golang Pulp Operator (NEW_SUBSCRIPTION_SOURCE)")
+	flags.StringVar(&opts.sourceNamespace, "source-namespace", envOr("NEW_SUBSCRIPTION_SOURCE_NAMESPACE", "openshift-marketplace"), "namespace of the CatalogSource (NEW_SUBSCRIPTION_SOURCE_NAMESPACE)")
+	flags.StringVar(&opts.indexImage, "index-image", os.Getenv("NEW_SUBSCRIPTION_INDEX_IMAGE"), "index image of the golang Pulp Operator, the -source CatalogSource is created from it if it does not exist (NEW_SUBSCRIPTION_INDEX_IMAGE)")
+	flags.StringVar(&opts.startingCSV, "starting-csv", envOr("NEW_SUBSCRIPTION_STARTING_CSV", "pulp-operator.v1.0.0-alpha.5"), "version of the golang Pulp Operator to install (NEW_SUBSCRIPTION_STARTING_CSV)")
+	flags.StringVar(&opts.newApi, "new-api", envOr("NEW_PULP_API", "repo-manager.pulpproject.org/v1alpha1"), "golang Pulp Operator APIVersion (NEW_PULP_API)")
+	flags.StringVar(&opts.newKind, "new-kind", envOr("NEW_PULP_KIND", "Pulp"), "golang Pulp Operator Kind (NEW_PULP_KIND)")
+	flags.StringVar(&opts.newResource, "new-resource", os.Getenv("NEW_PULP_RESOURCE"), "golang Pulp Operator resource type, defaults to -resource (NEW_PULP_RESOURCE)")
+	flags.BoolVar(&opts.dryRun, "dry-run", envBool("DRY_RUN", false), "print every change instead of modifying the cluster (DRY_RUN)")
+	flags.BoolVar(&opts.rollbackOnFailure, "rollback-on-failure", envBool("ROLLBACK_ON_FAILURE", true), "restore the modified resources when a step fails (ROLLBACK_ON_FAILURE)")
+	flags.BoolVar(&opts.skipPreflight, "skip-preflight", envBool("SKIP_PREFLIGHT", false), "skip the pre-flight checks (SKIP_PREFLIGHT)")
+	flags.StringVar(&opts.reportFormat, "report", envOr("REPORT_FORMAT", "text"), "format of the conversion report, text or json (REPORT_FORMAT)")
+	flags.StringVar(&opts.backupMethod, "backup", envOr("PRE_MIGRATION_BACKUP", backupNone), "back up the installation before changing it, none, cr (ansible PulpBackup CR) or pg-dump (PRE_MIGRATION_BACKUP)")
+	flags.BoolVar(&opts.convertRestores, "convert-restores", envBool("CONVERT_RESTORES", false), "convert the unfinished ansible restores, the golang Pulp Operator runs them against the migrated installation (CONVERT_RESTORES)")
+	flags.BoolVar(&opts.approveInstallPlan, "approve-install-plan", envBool("APPROVE_INSTALL_PLAN", false), "approve the InstallPlan of -starting-csv when -install-plan-approval is Manual (APPROVE_INSTALL_PLAN)")
+	flags.BoolVar(&opts.adjustOperatorGroup, "adjust-operator-group", envBool("ADJUST_OPERATOR_GROUP", false), "create the OperatorGroup of -namespace, or change its target namespaces, when it does not support the install modes of -starting-csv (ADJUST_OPERATOR_GROUP)")
+	flags.DurationVar(&opts.operatorTimeout, "operator-timeout", envDuration("OPERATOR_TIMEOUT", 10*time.Minute), "how long to wait for the golang Pulp Operator CSV to succeed, or its deployment to be ready without OLM (OPERATOR_TIMEOUT)")
+	flags.StringVar(&opts.operatorManifests, "operator-manifests", os.Getenv("OPERATOR_MANIFESTS"), "file or directory with the golang Pulp Operator manifests applied when OLM is not installed, the embedded ones if not provided (OPERATOR_MANIFESTS)")
+	flags.DurationVar(&opts.verifyTimeout, "verify-timeout", envDuration("VERIFY_TIMEOUT", 15*time.Minute), "how long to wait for the golang Pulp Operator to bring the migrated installation up, 0 skips the verification (VERIFY_TIMEOUT)")
+	flags.DurationVar(&opts.backupTimeout, "backup-timeout", envDuration("BACKUP_TIMEOUT", 30*time.Minute), "how long to wait for the pre-migration backup (BACKUP_TIMEOUT)")
+
+	// CONVERTION_ONLY is kept for the Jobs created before it was renamed
+	opts.conversionOnly = envBool("CONVERSION_ONLY", envBool("CONVERTION_ONLY", false))
+	return flags, opts
+}
+
+// validate checks the required options and the enum values, and fills the
+// options whose default is another option
+func (opts *options) validate() error {
+	if opts.namespace == "" && !opts.batch {
+		return fmt.Errorf("missing -namespace (PULP_NAMESPACE)")
+	}
+	if opts.resourceName == "" && !opts.batch {
+		return fmt.Errorf("missing -name (PULP_RESOURCE_NAME)")
+	}
+	if opts.installPlanApproval != "Automatic" && opts.installPlanApproval != "Manual" {
+		return fmt.Errorf("invalid -install-plan-approval (NEW_SUBSCRIPTION_INSTALL_PLAN_APPROVAL) %q, must be one of Automatic or Manual", opts.installPlanApproval)
+	}
+	opts.reportFormat = strings.ToLower(opts.reportFormat)
+	if opts.reportFormat != "text" && opts.reportFormat != "json" {
+		return fmt.Errorf("invalid -report (REPORT_FORMAT) %q, must be one of text or json", opts.reportFormat)
+	}
+	opts.backupMethod = strings.ToLower(opts.backupMethod)
+	if opts.backupMethod != backupNone && opts.backupMethod != backupCR && opts.backupMethod != backupPGDump {
+		return fmt.Errorf("invalid -backup (PRE_MIGRATION_BACKUP) %q, must be one of none, cr or pg-dump", opts.backupMethod)
+	}
+
+	if opts.newResource == "" {
+		opts.newResource = opts.resource
+	}
+	// in batch mode they are defined for each Pulp CR
+	if opts.batch {
+		return nil
+	}
+	if opts.newResourceName == "" {
+		opts.newResourceName = opts.resourceName
+	}
+	if opts.newSubscriptionName == "" {
+		opts.newSubscriptionName = opts.subscriptionName
+	}
+	return nil
+}
+
+// newPulp returns the migrator state built from the options
+func (opts *options) newPulp() *pulp {
+	return &pulp{
+		oldSubscriptionName:                opts.subscriptionName,
+		oldSubscriptionNamespace:           opts.namespace,
+		newSubscriptionNamespace:           opts.namespace,
+		newSubscriptionName:                opts.newSubscriptionName,
+		newSubscriptionChannel:             opts.channel,
+		newSubscriptionInstallPlanApproval: opts.installPlanApproval,
+		newSubscriptionSource:              opts.source,
+		newSubscriptionSourceNamespace:     opts.sourceNamespace,
+		newSubscriptionStartingCSV:         opts.startingCSV,
+		indexImage:                         opts.indexImage,
+		newApi:                             opts.newApi,
+		newKind:                            opts.newKind,
+		newResourceName:                    opts.newResourceName,
+		newResource:                        opts.newResource,
+		oldApi:                             opts.api,
+		oldResource:                        opts.resource,
+		oldResourceName:                    opts.resourceName,
+		dryRun:                             opts.dryRun,
+		reportFormat:                       opts.reportFormat,
+		backupMethod:                       opts.backupMethod,
+		backupTimeout:                      opts.backupTimeout,
+		convertRestores:                    opts.convertRestores,
+		approveInstallPlan:                 opts.approveInstallPlan,
+		adjustOperatorGroup:                opts.adjustOperatorGroup,
+		operatorTimeout:                    opts.operatorTimeout,
+		operatorManifests:                  opts.operatorManifests,
+		verifyTimeout:                      opts.verifyTimeout,
+		rollbackOnFailure:                  opts.rollbackOnFailure,
+		original:                           &originalState{},
+	}
+}
+
+// run executes the command in args and returns an error if it fails
+func run(args []string) error {
+	command := "migrate"
+	if len(args) > 0 && (!strings.HasPrefix(args[0], "-") || args[0] == "-h" || args[0] == "-help" || args[0] == "--help") {
+		command, args = args[0], args[1:]
+	}
+
+	var err error
+	switch command {
+	case "-h", "-help", "--help":
+		fmt.Print(usage)
+		return nil
+	case "migrate":
+		err = runMigrate(command, args, false)
+	case "plan":
+		err = runMigrate(command, args, true)
+	case "convert":
+		err = runConvert(args)
+	case "rollback":
+		err = runRollback(args)
+	case "batch":
+		err = runBatch(args)
+	case "status":
+		err = runStatus(args)
+	case "preflight":
+		err = runPreflight(args)
+	case "verify":
+		err = runVerify(args)
+	case "help":
+		fmt.Print(usage)
+		return nil
+	default:
+		fmt.Fprintf(os.Stderr, "❌ Unknown command %q\n\n%s", command, usage)
+		return fmt.Errorf("unknown command %q", command)
+	}
+	if errors.Is(err, flag.ErrHelp) {
+		return nil
+	}
+	return err
+}
+
+// parse parses the flags of a command that talks to the cluster and
+// returns its client
+func parse(flags *flag.FlagSet, opts *options, args []string) (cluster, error) {
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: pulp-migrator %s [flags]\n\nFlags:\n", flags.Name())
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+	return opts.connect()
+}
+
+// connect validates the options and returns a client for the cluster
+func (opts *options) connect() (cluster, error) {
+	if err := opts.validate(); err != nil {
+		fmt.Println("❌ Invalid configuration:", err)
+		return nil, err
+	}
+	config, err := ctrl.GetConfig()
+	if err != nil {
+		fmt.Println("❌ Failed to load the cluster configuration:", err)
+		return nil, err
+	}
+	c, err := newCluster(config)
+	if err != nil {
+		fmt.Println("❌ Failed to create the cluster client:", err)
+		return nil, err
+	}
+	return c, nil
+}
+
+// runMigrate runs the migration, planOnly forces the dry-run mode
+func runMigrate(name string, args []string, planOnly bool) error {
+	flags, opts := newFlagSet(name)
+	flags.BoolVar(&opts.conversionOnly, "conversion-only", opts.conversionOnly, "only create the golang Pulp CR (CONVERSION_ONLY)")
+	c, err := parse(flags, opts, args)
+	if err != nil {
+		return err
+	}
+	if planOnly {
+		opts.dryRun = true
+	}
+	if opts.dryRun {
+		fmt.Println("📝 Running in dry-run mode, no changes will be made to the cluster")
+	}
+	return opts.newPulp().migrate(c, opts)
+}
+
+// runConvert creates only the golang Pulp CR, or converts a manifest
+// without contacting the cluster when -f is provided
+func runConvert(args []string) error {
+	flags, opts := newFlagSet("convert")
+	offline := addOfflineFlags(flags)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: pulp-migrator convert [flags]\n\nFlags:\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	fileProvided := false
+	flags.Visit(func(f *flag.Flag) { fileProvided = fileProvided || f.Name == "f" })
+	if fileProvided {
+		if err := runOfflineConversion(offline, opts); err != nil {
+			fmt.Fprintln(os.Stderr, "❌ Failed to convert Pulp CR:", err)
+			return err
+		}
+		return nil
+	}
+
+	c, err := opts.connect()
+	if err != nil {
+		return err
+	}
+	opts.conversionOnly = true
+	return opts.newPulp().migrate(c, opts)
+}
+
+// runRollback restores the resources changed by an unfinished migration,
+// based on the state recorded in the checkpoint ConfigMap
+func runRollback(args []string) error {
+	flags, opts := newFlagSet("rollback")
+	c, err := parse(flags, opts, args)
+	if err != nil {
+		return err
+	}
+	pulp := opts.newPulp()
+	if err := pulp.loadCheckpoint(c); err != nil {
+		return err
+	}
+	if !pulp.checkpoint.exists {
+		fmt.Println("❌ No migration state found in", pulp.checkpointName(), "ConfigMap, there is nothing to rollback")
+		return fmt.Errorf("migration state not found")
+	}
+	if err := pulp.rollback(c); err != nil {
+		return err
+	}
+	return pulp.deleteCheckpoint(c)
+}
+
+// runStatus prints the steps already completed and the pending ones
+func runStatus(args []string) error {
+	flags, opts := newFlagSet("status")
+	c, err := parse(flags, opts, args)
+	if err != nil {
+		return err
+	}
+	pulp := opts.newPulp()
+	if err := pulp.prepare(c); err != nil {
+		return err
+	}
+	if !pulp.checkpoint.exists {
+		fmt.Println("No migration in progress,", pulp.checkpointName(), "ConfigMap not found")
+		return nil
+	}
+
+	fmt.Println("Migration state from", pulp.checkpointName(), "ConfigMap:")
+	for _, step := range pulp.migrationSteps(c, opts.conversionOnly) {
+		if pulp.checkpoint.completed(step.name) {
+			fmt.Println("  ✅", step.name)
+		} else {
+			fmt.Println("  ⏳", step.name)
+		}
+	}
+	return nil
+}
+
+// runPreflight only verifies if the cluster is ready to be migrated
+func runPreflight(args []string) error {
+	flags, opts := newFlagSet("preflight")
+	flags.BoolVar(&opts.conversionOnly, "conversion-only", opts.conversionOnly, "only check what is needed to create the golang Pulp CR (CONVERSION_ONLY)")
+	c, err := parse(flags, opts, args)
+	if err != nil {
+		return err
+	}
+	pulp := opts.newPulp()
+	if err := pulp.prepare(c); err != nil {
+		return err
+	}
+	return pulp.preflight(c, opts.conversionOnly)
+}
+
+// runVerify only verifies the installation of a finished migration
+func runVerify(args []string) error {
+	flags, opts := newFlagSet("verify")
+	c, err := parse(flags, opts, args)
+	if err != nil {
+		return err
+	}
+	pulp := opts.newPulp()
+	if err := pulp.prepare(c); err != nil {
+		return err
+	}
+	return pulp.verify(c)
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+
+	configv1 "github.com/openshift/api/config/v1"
+	routev1 "github.com/openshift/api/route/v1"
+	operatorsv1 "github.com/operator-framework/api/pkg/operators/v1"
+	operatorsv1alpha1 "github.com/operator-framework/api/pkg/operators/v1alpha1"
+	repomanagerv1alpha1 "github.com/pulp/pulp-operator/api/v1alpha1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/kubernetes"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// scheme holds the types of the APIs the migrator talks to
+var scheme = newScheme()
+
+// newScheme returns a scheme with the types of the APIs the migrator talks to
+func newScheme() *runtime.Scheme {
+	s := runtime.NewScheme()
+	utilruntime.Must(clientgoscheme.AddToScheme(s))
+	utilruntime.Must(operatorsv1.AddToScheme(s))
+	utilruntime.Must(operatorsv1alpha1.AddToScheme(s))
+	utilruntime.Must(configv1.Install(s))
+	utilruntime.Must(routev1.Install(s))
+	utilruntime.Must(repomanagerv1alpha1.AddToScheme(s))
+	return s
+}
+
+// cluster is the client of the Kubernetes API used by the migrator.
+// The ansible CRs, the golang Pulp CR (whose api is configurable) and the
+// PackageManifests are handled as unstructured objects, everything else
+// through the types registered in the scheme.
+type cluster interface {
+	client.Client
+
+	// proxyGet sends a GET request to a Service port through the API server proxy
+	proxyGet(namespace, service, port, path string) ([]byte, error)
+}
+
+var _ cluster = apiCluster{}
+
+// apiCluster is the cluster reached through the API server in the kubeconfig
+type apiCluster struct {
+	client.Client
+
+	// used for the requests not supported by the controller-runtime client
+	clientset kubernetes.Interface
+}
+
+// newCluster returns the client of the cluster defined in config
+func newCluster(config *rest.Config) (cluster, error) {
+	c, err := client.New(config, client.Options{Scheme: scheme})
+	if err != nil {
+		return nil, err
+	}
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	return apiCluster{Client: c, clientset: clientset}, nil
+}
+
+func (c apiCluster) proxyGet(namespace, service, port, path string) ([]byte, error) {
+	return c.clientset.CoreV1().Services(namespace).ProxyGet("", service, port, path, nil).DoRaw(context.TODO())
+}
+
+// kindFor returns the kind of the resource (like pulps) served in apiVersion
+func kindFor(c cluster, apiVersion, resource string) (string, error) {
+	gv, err := schema.ParseGroupVersion(apiVersion)
+	if err != nil {
+		return "", err
+	}
+	gvk, err := c.RESTMapper().KindFor(gv.WithResource(resource))
+	if err != nil {
+		return "", err
+	}
+	return gvk.Kind, nil
+}
+
+// isMissing returns true if the object, or the CRD of its kind, was not found
+func isMissing(err error) bool {
+	return apierrors.IsNotFound(err) || meta.IsNoMatchError(err)
+}
+
+// newUnstructured returns an empty object of the given apiVersion and kind
+func newUnstructured(apiVersion, kind string) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{}
+	obj.SetAPIVersion(apiVersion)
+	obj.SetKind(kind)
+	return obj
+}
+
+// newUnstructuredList returns an empty list of objects of the given apiVersion and kind
+func newUnstructuredList(apiVersion, kind string) *unstructured.UnstructuredList {
+	list := &unstructured.UnstructuredList{}
+	list.SetAPIVersion(apiVersion)
+	list.SetKind(kind + "List")
+	return list
+}
+
+// fromUnstructured decodes unstructured content (an object or a list of
+// them) into obj, through its json tags
+func fromUnstructured(content any, obj any) error {
+	data, err := json.Marshal(content)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, obj)
+}
+
+// toUnstructured encodes obj, through its json tags, into an unstructured object
+func toUnstructured(obj any) (*unstructured.Unstructured, error) {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+	u := &unstructured.Unstructured{}
+	if err := u.UnmarshalJSON(data); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
@@ -0,0 +1,360 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	operatorsv1alpha1 "github.com/operator-framework/api/pkg/operators/v1alpha1"
+	repomanagerv1alpha1 "github.com/pulp/pulp-operator/api/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// fakeCluster is a cluster backed by the controller-runtime fake client.
+// Nothing reconciles the objects of a fake client, so it also plays the part
+// of OLM (serving a new CatalogSource and installing the CSV of a new
+// Subscription), of the golang operator
+// (bringing up the resources of a new golang Pulp CR) and of the ansible
+// operator and the Job controller (finishing the pre-migration backups).
+type fakeCluster struct {
+	client.WithWatch
+
+	// the first request matching "<verb> <kind>" (like "delete Subscription")
+	// fails, the verbs are get, list, create, update, patch, delete and
+	// deletecollection
+	failOn string
+	// the number of requests matching failOn that succeed before the
+	// failing one
+	failAfter int
+
+	// the SelfSubjectAccessReviews of "<verb> <resource>" (like "delete
+	// configmaps") are denied, every other request is allowed
+	forbidden []string
+
+	// the golang operator does not bring the installation up
+	operatorDown bool
+}
+
+var _ cluster = &fakeCluster{}
+
+// crdKinds are the kinds served by CRDs whose types are not in the scheme
+var crdKinds = []schema.GroupVersionKind{
+	{Group: "pulp.pulpproject.org", Version: "v1beta1", Kind: "Pulp"},
+	{Group: "pulp.pulpproject.org", Version: "v1beta1", Kind: "PulpBackup"},
+	{Group: "pulp.pulpproject.org", Version: "v1beta1", Kind: "PulpRestore"},
+	{Group: "packages.operators.coreos.com", Version: "v1", Kind: "PackageManifest"},
+	{Group: "apiextensions.k8s.io", Version: "v1", Kind: "CustomResourceDefinition"},
+}
+
+// clusterScoped are the kinds used by the migrator that are not namespaced
+var clusterScoped = map[schema.GroupKind]bool{
+	{Group: "", Kind: "Namespace"}:                                    true,
+	{Group: "rbac.authorization.k8s.io", Kind: "ClusterRole"}:         true,
+	{Group: "rbac.authorization.k8s.io", Kind: "ClusterRoleBinding"}:  true,
+	{Group: "apiextensions.k8s.io", Kind: "CustomResourceDefinition"}: true,
+	{Group: "config.openshift.io", Kind: "Ingress"}:                   true,
+	{Group: "networking.k8s.io", Kind: "IngressClass"}:                true,
+}
+
+// newFakeCluster returns a fakeCluster with the given objects
+func newFakeCluster(objs ...client.Object) *fakeCluster {
+	return buildFakeCluster(true, objs)
+}
+
+// newFakeClusterWithoutOLM returns a fakeCluster with the given objects that
+// does not serve the OLM APIs
+func newFakeClusterWithoutOLM(objs ...client.Object) *fakeCluster {
+	return buildFakeCluster(false, objs)
+}
+
+func buildFakeCluster(olm bool, objs []client.Object) *fakeCluster {
+	// the fake client registers the unstructured lists in its scheme, so each
+	// cluster gets its own
+	fakeScheme := newScheme()
+	mapper := meta.NewDefaultRESTMapper(nil)
+	for _, gvk := range append(crdKinds, allKinds(fakeScheme)...) {
+		if !olm && strings.HasSuffix(gvk.Group, "operators.coreos.com") {
+			continue
+		}
+		scope := meta.RESTScopeNamespace
+		if clusterScoped[gvk.GroupKind()] {
+			scope = meta.RESTScopeRoot
+		}
+		mapper.Add(gvk, scope)
+	}
+
+	return &fakeCluster{
+		WithWatch: fake.NewClientBuilder().
+			WithScheme(fakeScheme).
+			WithRESTMapper(mapper).
+			WithObjects(objs...).
+			Build(),
+	}
+}
+
+// allKinds returns the kinds registered in the scheme
+func allKinds(s *runtime.Scheme) []schema.GroupVersionKind {
+	kinds := []schema.GroupVersionKind{}
+	for gvk := range s.AllKnownTypes() {
+		kinds = append(kinds, gvk)
+	}
+	return kinds
+}
+
+// fail returns an error the first time a request matches failOn, after
+// failAfter matching requests
+func (c *fakeCluster) fail(verb string, obj runtime.Object) error {
+	if c.failOn == "" {
+		return nil
+	}
+	gvk, err := apiutil.GVKForObject(obj, c.Scheme())
+	if err != nil {
+		return err
+	}
+	if c.failOn != verb+" "+strings.TrimSuffix(gvk.Kind, "List") {
+		return nil
+	}
+	if c.failAfter > 0 {
+		c.failAfter--
+		return nil
+	}
+	c.failOn = ""
+	return apierrors.NewInternalError(fmt.Errorf("injected failure on %s %s", verb, gvk.Kind))
+}
+
+func (c *fakeCluster) Get(ctx context.Context, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+	if err := c.fail("get", obj); err != nil {
+		return err
+	}
+	return c.WithWatch.Get(ctx, key, obj, opts...)
+}
+
+func (c *fakeCluster) List(ctx context.Context, list client.ObjectList, opts ...client.ListOption) error {
+	if err := c.fail("list", list); err != nil {
+		return err
+	}
+	return c.WithWatch.List(ctx, list, opts...)
+}
+
+func (c *fakeCluster) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	if err := c.fail("create", obj); err != nil {
+		return err
+	}
+	if review, ok := obj.(*authorizationv1.SelfSubjectAccessReview); ok {
+		attributes := review.Spec.ResourceAttributes
+		review.Status.Allowed = true
+		for _, forbidden := range c.forbidden {
+			if forbidden == attributes.Verb+" "+attributes.Resource {
+				review.Status.Allowed = false
+			}
+		}
+		return nil
+	}
+	if err := c.WithWatch.Create(ctx, obj, opts...); err != nil {
+		return err
+	}
+
+	createOpts := &client.CreateOptions{}
+	createOpts.ApplyOptions(opts)
+	if len(createOpts.DryRun) > 0 {
+		return nil
+	}
+	switch obj := obj.(type) {
+	case *operatorsv1alpha1.CatalogSource:
+		obj.Status.GRPCConnectionState = &operatorsv1alpha1.GRPCConnectionState{LastObservedState: "READY"}
+		return c.WithWatch.Update(ctx, obj)
+	case *operatorsv1alpha1.Subscription:
+		return c.installCSV(ctx, obj)
+	case *batchv1.Job:
+		obj.Status.Succeeded = 1
+		return c.WithWatch.Update(ctx, obj)
+	case *unstructured.Unstructured:
+		if obj.GetAPIVersion() == "pulp.pulpproject.org/v1beta1" && obj.GetKind() == "PulpBackup" {
+			obj.Object["status"] = map[string]any{
+				"backupClaim":     "example-pulp-backup-claim",
+				"backupDirectory": "/backups/openshift-backup-2023-01-01",
+				"conditions":      []any{map[string]any{"type": "Successful", "status": "True"}},
+			}
+			return c.WithWatch.Update(ctx, obj)
+		}
+		if obj.GetAPIVersion() == repomanagerv1alpha1.GroupVersion.String() && obj.GetKind() == "Pulp" && !c.operatorDown {
+			return c.reconcile(ctx, obj)
+		}
+		if obj.GetKind() == "Deployment" && obj.GetLabels()["control-plane"] == "controller-manager" && !c.operatorDown {
+			return c.startDeployment(ctx, client.ObjectKeyFromObject(obj))
+		}
+	}
+	return nil
+}
+
+func (c *fakeCluster) Update(ctx context.Context, obj client.Object, opts ...client.UpdateOption) error {
+	if err := c.fail("update", obj); err != nil {
+		return err
+	}
+	return c.WithWatch.Update(ctx, obj, opts...)
+}
+
+func (c *fakeCluster) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+	if err := c.fail("patch", obj); err != nil {
+		return err
+	}
+	return c.WithWatch.Patch(ctx, obj, patch, opts...)
+}
+
+func (c *fakeCluster) Delete(ctx context.Context, obj client.Object, opts ...client.DeleteOption) error {
+	if err := c.fail("delete", obj); err != nil {
+		return err
+	}
+	if err := c.WithWatch.Delete(ctx, obj, opts...); err != nil {
+		return err
+	}
+
+	deleteOpts := &client.DeleteOptions{}
+	deleteOpts.ApplyOptions(opts)
+	if len(deleteOpts.DryRun) > 0 {
+		return nil
+	}
+	if cr, ok := obj.(*unstructured.Unstructured); ok && cr.GetAPIVersion() == repomanagerv1alpha1.GroupVersion.String() && cr.GetKind() == "Pulp" {
+		return c.collectGarbage(ctx, cr)
+	}
+	return nil
+}
+
+func (c *fakeCluster) DeleteAllOf(ctx context.Context, obj client.Object, opts ...client.DeleteAllOfOption) error {
+	if err := c.fail("deletecollection", obj); err != nil {
+		return err
+	}
+	return c.WithWatch.DeleteAllOf(ctx, obj, opts...)
+}
+
+func (c *fakeCluster) SubResource(subResource string) client.SubResourceClient {
+	return fakeSubResourceClient{c.WithWatch.SubResource(subResource), c}
+}
+
+func (c *fakeCluster) proxyGet(namespace, service, port, path string) ([]byte, error) {
+	if c.operatorDown {
+		return nil, apierrors.NewServiceUnavailable("no endpoints available for service " + service)
+	}
+	return []byte(`{"database_connection":{"connected":true}}`), nil
+}
+
+// installCSV does what OLM does with a new Subscription
+func (c *fakeCluster) installCSV(ctx context.Context, sub *operatorsv1alpha1.Subscription) error {
+	csv := &operatorsv1alpha1.ClusterServiceVersion{
+		ObjectMeta: metav1.ObjectMeta{Name: sub.Spec.StartingCSV, Namespace: sub.Namespace},
+		Status:     operatorsv1alpha1.ClusterServiceVersionStatus{Phase: operatorsv1alpha1.CSVPhaseSucceeded},
+	}
+	if err := c.WithWatch.Create(ctx, csv); err != nil && !apierrors.IsAlreadyExists(err) {
+		return err
+	}
+	sub.Status.CurrentCSV = csv.Name
+	sub.Status.InstalledCSV = csv.Name
+	return c.WithWatch.Update(ctx, sub)
+}
+
+// startDeployment does what the kubelet does with the pods of a new Deployment
+func (c *fakeCluster) startDeployment(ctx context.Context, key client.ObjectKey) error {
+	deployment := &appsv1.Deployment{}
+	if err := c.WithWatch.Get(ctx, key, deployment); err != nil {
+		return err
+	}
+	deployment.Status.ReadyReplicas = 1
+	if deployment.Spec.Replicas != nil {
+		deployment.Status.ReadyReplicas = *deployment.Spec.Replicas
+	}
+	return c.WithWatch.Update(ctx, deployment)
+}
+
+// reconcile does what the golang operator does with a new Pulp CR
+func (c *fakeCluster) reconcile(ctx context.Context, cr *unstructured.Unstructured) error {
+	pulpNew := &repomanagerv1alpha1.Pulp{}
+	if err := fromUnstructured(cr.Object, pulpNew); err != nil {
+		return err
+	}
+
+	labels := map[string]string{"app": "postgresql", "pulp_cr": pulpNew.Name}
+	objs := []client.Object{
+		&appsv1.StatefulSet{
+			ObjectMeta: metav1.ObjectMeta{Name: pulpNew.Name + "-database", Namespace: pulpNew.Namespace},
+			Spec:       appsv1.StatefulSetSpec{Selector: &metav1.LabelSelector{MatchLabels: labels}},
+			Status:     appsv1.StatefulSetStatus{ReadyReplicas: 1},
+		},
+		&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: pulpNew.Name + "-database-0", Namespace: pulpNew.Namespace, Labels: labels},
+			Spec: corev1.PodSpec{Volumes: []corev1.Volume{{
+				Name: "postgres",
+				VolumeSource: corev1.VolumeSource{
+					PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: pulpNew.Spec.Database.PVC},
+				},
+			}}},
+		},
+	}
+	for _, component := range []string{"api", "content", "worker", "web"} {
+		objs = append(objs, &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: pulpNew.Name + "-" + component, Namespace: pulpNew.Namespace},
+			Status:     appsv1.DeploymentStatus{ReadyReplicas: 1},
+		})
+	}
+	for _, obj := range objs {
+		if err := c.WithWatch.Create(ctx, obj); err != nil {
+			return err
+		}
+	}
+
+	pulpNew.Status.Conditions = []metav1.Condition{{
+		Type:               "Pulp-Operator-Finished-Execution",
+		Status:             metav1.ConditionTrue,
+		Reason:             "OperatorFinishedExecution",
+		LastTransitionTime: metav1.Now(),
+	}}
+	reconciled, err := toUnstructured(pulpNew)
+	if err != nil {
+		return err
+	}
+	cr.Object["status"] = reconciled.Object["status"]
+	return c.WithWatch.Update(ctx, cr)
+}
+
+// collectGarbage removes the objects created by reconcile for a deleted
+// Pulp CR, like the garbage collector does with the objects it owns
+func (c *fakeCluster) collectGarbage(ctx context.Context, cr *unstructured.Unstructured) error {
+	objs := []client.Object{
+		&appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{Name: cr.GetName() + "-database", Namespace: cr.GetNamespace()}},
+		&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: cr.GetName() + "-database-0", Namespace: cr.GetNamespace()}},
+	}
+	for _, component := range []string{"api", "content", "worker", "web"} {
+		objs = append(objs, &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: cr.GetName() + "-" + component, Namespace: cr.GetNamespace()}})
+	}
+	for _, obj := range objs {
+		if err := c.WithWatch.Delete(ctx, obj); err != nil && !apierrors.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// fakeSubResourceClient injects the failures of a fakeCluster in the
+// requests to subresources (like scale)
+type fakeSubResourceClient struct {
+	client.SubResourceClient
+	cluster *fakeCluster
+}
+
+func (c fakeSubResourceClient) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.SubResourcePatchOption) error {
+	if err := c.cluster.fail("patch", obj); err != nil {
+		return err
+	}
+	return c.SubResourceClient.Patch(ctx, obj, patch, opts...)
+}
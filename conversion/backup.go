@@ -0,0 +1,164 @@
+package conversion
+
+import (
+	repomanagerv1alpha1 "github.com/pulp/pulp-operator/api/v1alpha1"
+)
+
+// AnsibleBackupSpec is the spec of the ansible PulpBackup CR (pulp.pulpproject.org/v1beta1)
+type AnsibleBackupSpec struct {
+	DeploymentType            string `json:"deployment_type,omitempty"`
+	DeploymentName            string `json:"deployment_name,omitempty"`
+	BackupPVC                 string `json:"backup_pvc,omitempty"`
+	BackupPVCNamespace        string `json:"backup_pvc_namespace,omitempty"`
+	BackupStorageRequirements string `json:"backup_storage_requirements,omitempty"`
+	BackupStorageClass        string `json:"backup_storage_class,omitempty"`
+	PostgresLabelSelector     string `json:"postgres_label_selector,omitempty"`
+}
+
+// AnsibleBackupStatus is the status of the ansible PulpBackup CR, it holds
+// where the backup was stored
+type AnsibleBackupStatus struct {
+	BackupClaim     string             `json:"backupClaim,omitempty"`
+	BackupNamespace string             `json:"backupNamespace,omitempty"`
+	BackupDirectory string             `json:"backupDirectory,omitempty"`
+	Conditions      []AnsibleCondition `json:"conditions,omitempty"`
+}
+
+// AnsibleRestoreSpec is the spec of the ansible PulpRestore CR (pulp.pulpproject.org/v1beta1)
+type AnsibleRestoreSpec struct {
+	DeploymentType        string `json:"deployment_type,omitempty"`
+	DeploymentName        string `json:"deployment_name,omitempty"`
+	BackupSource          string `json:"backup_source,omitempty"`
+	BackupName            string `json:"backup_name,omitempty"`
+	BackupPVC             string `json:"backup_pvc,omitempty"`
+	BackupPVCNamespace    string `json:"backup_pvc_namespace,omitempty"`
+	BackupDir             string `json:"backup_dir,omitempty"`
+	PostgresLabelSelector string `json:"postgres_label_selector,omitempty"`
+}
+
+// AnsibleRestoreStatus is the status of the ansible PulpRestore CR
+type AnsibleRestoreStatus struct {
+	RestoreComplete bool               `json:"restoreComplete,omitempty"`
+	Conditions      []AnsibleCondition `json:"conditions,omitempty"`
+}
+
+// AnsibleCondition is a condition set by the ansible operator
+type AnsibleCondition struct {
+	Type   string `json:"type"`
+	Status string `json:"status"`
+}
+
+// Completed returns true if the ansible operator finished the restore
+func (status AnsibleRestoreStatus) Completed() bool {
+	return status.RestoreComplete || conditionTrue(status.Conditions, "Successful")
+}
+
+// Completed returns true if the ansible operator finished the backup
+func (status AnsibleBackupStatus) Completed() bool {
+	return len(status.BackupDirectory) > 0 && conditionTrue(status.Conditions, "Successful")
+}
+
+// Failed returns true if the last run of the ansible backup failed
+func (status AnsibleBackupStatus) Failed() bool {
+	return conditionTrue(status.Conditions, "Failure")
+}
+
+// conditionTrue returns true if the condition is found with status True
+func conditionTrue(conditions []AnsibleCondition, conditionType string) bool {
+	for _, condition := range conditions {
+		if condition.Type == conditionType && condition.Status == "True" {
+			return true
+		}
+	}
+	return false
+}
+
+// ConvertBackup returns the golang PulpBackup CR spec equivalent to an ansible
+// PulpBackup CR, backing up the golang Pulp CR pulp.
+// The golang operator always stores new backups in the <backup name>-backup-claim
+// PVC, backup_pvc only records where the ansible backup was stored.
+func ConvertBackup(spec AnsibleBackupSpec, status AnsibleBackupStatus, pulp *repomanagerv1alpha1.Pulp) (repomanagerv1alpha1.PulpBackupSpec, []string) {
+	warnings := []string{}
+	backupSpec := repomanagerv1alpha1.PulpBackupSpec{
+		DeploymentType:              golangDeploymentType(pulp),
+		DeploymentName:              pulp.Name,
+		BackupPVC:                   spec.BackupPVC,
+		BackupPVCNamespace:          spec.BackupPVCNamespace,
+		BackupStorageReq:            spec.BackupStorageRequirements,
+		BackupSC:                    spec.BackupStorageClass,
+		AdminPasswordSecret:         pulp.Spec.AdminPasswordSecret,
+		PostgresConfigurationSecret: pulp.Spec.Database.ExternalDBSecret,
+	}
+
+	// the PVC and namespace used by the ansible operator are only in the status
+	// when they were not provided
+	if len(backupSpec.BackupPVC) == 0 {
+		backupSpec.BackupPVC = status.BackupClaim
+	}
+	if len(backupSpec.BackupPVCNamespace) == 0 {
+		backupSpec.BackupPVCNamespace = status.BackupNamespace
+	}
+	if len(backupSpec.AdminPasswordSecret) == 0 {
+		backupSpec.AdminPasswordSecret = pulp.Name + "-admin-password"
+	}
+	if len(backupSpec.PostgresConfigurationSecret) == 0 {
+		backupSpec.PostgresConfigurationSecret = pulp.Name + "-postgres-configuration"
+	}
+
+	if len(spec.DeploymentName) > 0 && spec.DeploymentName != pulp.Name {
+		warnings = append(warnings, "deployment_name: the backup pointed to "+spec.DeploymentName+", it will back up "+pulp.Name+" instead")
+	}
+	if len(spec.PostgresLabelSelector) > 0 {
+		warnings = append(warnings, "postgres_label_selector: golang operator finds the database through postgres_configuration_secret, the selector will be ignored")
+	}
+	return backupSpec, warnings
+}
+
+// ConvertRestore returns the golang PulpRestore CR spec equivalent to an
+// ansible PulpRestore CR, restoring into the golang Pulp CR pulp.
+// backup is the status of the ansible PulpBackup CR named in backup_name (if
+// found), used to point the restore to the PVC and directory of the ansible
+// backup instead of the ones of the golang backup.
+func ConvertRestore(spec AnsibleRestoreSpec, backup *AnsibleBackupStatus, pulp *repomanagerv1alpha1.Pulp) (repomanagerv1alpha1.PulpRestoreSpec, []string) {
+	warnings := []string{}
+	restoreSpec := repomanagerv1alpha1.PulpRestoreSpec{
+		DeploymentType:     golangDeploymentType(pulp),
+		DeploymentName:     pulp.Name,
+		BackupSource:       spec.BackupSource,
+		BackupName:         spec.BackupName,
+		BackupPVC:          spec.BackupPVC,
+		BackupPVCNamespace: spec.BackupPVCNamespace,
+		BackupDir:          spec.BackupDir,
+	}
+
+	if backup != nil {
+		if len(restoreSpec.BackupPVC) == 0 {
+			restoreSpec.BackupPVC = backup.BackupClaim
+		}
+		if len(restoreSpec.BackupPVCNamespace) == 0 {
+			restoreSpec.BackupPVCNamespace = backup.BackupNamespace
+		}
+		if len(restoreSpec.BackupDir) == 0 {
+			restoreSpec.BackupDir = backup.BackupDirectory
+		}
+	} else if len(spec.BackupName) > 0 && len(spec.BackupPVC) == 0 {
+		warnings = append(warnings, "backup_pvc: the "+spec.BackupName+" backup was not found, the restore will use the "+spec.BackupName+"-backup-claim PVC")
+	}
+
+	if len(spec.DeploymentName) > 0 && spec.DeploymentName != pulp.Name {
+		warnings = append(warnings, "deployment_name: the restore pointed to "+spec.DeploymentName+", it will restore "+pulp.Name+" instead")
+	}
+	if len(spec.PostgresLabelSelector) > 0 {
+		warnings = append(warnings, "postgres_label_selector: golang operator finds the database through postgres_configuration_secret, the selector will be ignored")
+	}
+	return restoreSpec, warnings
+}
+
+// golangDeploymentType returns the deployment_type of the golang Pulp CR,
+// which is also the one of its backups and restores
+func golangDeploymentType(pulp *repomanagerv1alpha1.Pulp) string {
+	if len(pulp.Spec.DeploymentType) == 0 {
+		return "pulp"
+	}
+	return pulp.Spec.DeploymentType
+}
@@ -0,0 +1,199 @@
+package conversion
+
+import (
+	"reflect"
+	"testing"
+
+	repomanagerv1alpha1 "github.com/pulp/pulp-operator/api/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestConvertBackup(t *testing.T) {
+	pulp := &repomanagerv1alpha1.Pulp{ObjectMeta: metav1.ObjectMeta{Name: "new-pulp"}}
+	externalDB := pulp.DeepCopy()
+	externalDB.Spec.DeploymentType = "galaxy"
+	externalDB.Spec.AdminPasswordSecret = "admin"
+	externalDB.Spec.Database.ExternalDBSecret = "new-pulp-external-database"
+
+	tests := []struct {
+		name         string
+		spec         AnsibleBackupSpec
+		status       AnsibleBackupStatus
+		pulp         *repomanagerv1alpha1.Pulp
+		expected     repomanagerv1alpha1.PulpBackupSpec
+		wantWarnings int
+	}{
+		{
+			name: "pvc from status",
+			spec: AnsibleBackupSpec{
+				DeploymentName:            "new-pulp",
+				BackupStorageRequirements: "10Gi",
+				BackupStorageClass:        "standard",
+			},
+			status: AnsibleBackupStatus{BackupClaim: "new-pulp-backup-claim", BackupNamespace: "pulp"},
+			pulp:   pulp,
+			expected: repomanagerv1alpha1.PulpBackupSpec{
+				DeploymentType:              "pulp",
+				DeploymentName:              "new-pulp",
+				BackupPVC:                   "new-pulp-backup-claim",
+				BackupPVCNamespace:          "pulp",
+				BackupStorageReq:            "10Gi",
+				BackupSC:                    "standard",
+				AdminPasswordSecret:         "new-pulp-admin-password",
+				PostgresConfigurationSecret: "new-pulp-postgres-configuration",
+			},
+		},
+		{
+			name: "pvc from spec",
+			spec: AnsibleBackupSpec{
+				DeploymentName:        "example-pulp",
+				BackupPVC:             "backups",
+				BackupPVCNamespace:    "backups",
+				PostgresLabelSelector: "app.kubernetes.io/instance=postgres-example-pulp",
+			},
+			status: AnsibleBackupStatus{BackupClaim: "example-pulp-backup-claim", BackupNamespace: "pulp"},
+			pulp:   externalDB,
+			expected: repomanagerv1alpha1.PulpBackupSpec{
+				DeploymentType:              "galaxy",
+				DeploymentName:              "new-pulp",
+				BackupPVC:                   "backups",
+				BackupPVCNamespace:          "backups",
+				AdminPasswordSecret:         "admin",
+				PostgresConfigurationSecret: "new-pulp-external-database",
+			},
+			wantWarnings: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec, warnings := ConvertBackup(tt.spec, tt.status, tt.pulp)
+			if !reflect.DeepEqual(spec, tt.expected) {
+				t.Errorf("ConvertBackup() = %+v, expected %+v", spec, tt.expected)
+			}
+			if len(warnings) != tt.wantWarnings {
+				t.Errorf("ConvertBackup() warnings = %v, expected %d", warnings, tt.wantWarnings)
+			}
+		})
+	}
+}
+
+func TestConvertRestore(t *testing.T) {
+	pulp := &repomanagerv1alpha1.Pulp{ObjectMeta: metav1.ObjectMeta{Name: "example-pulp"}}
+
+	tests := []struct {
+		name         string
+		spec         AnsibleRestoreSpec
+		backup       *AnsibleBackupStatus
+		expected     repomanagerv1alpha1.PulpRestoreSpec
+		wantWarnings int
+	}{
+		{
+			name: "from backup status",
+			spec: AnsibleRestoreSpec{DeploymentName: "example-pulp", BackupName: "nightly", BackupSource: "CR"},
+			backup: &AnsibleBackupStatus{
+				BackupClaim:     "example-pulp-backup-claim",
+				BackupNamespace: "pulp",
+				BackupDirectory: "/backups/openshift-backup-2022-12-01",
+			},
+			expected: repomanagerv1alpha1.PulpRestoreSpec{
+				DeploymentType:     "pulp",
+				DeploymentName:     "example-pulp",
+				BackupSource:       "CR",
+				BackupName:         "nightly",
+				BackupPVC:          "example-pulp-backup-claim",
+				BackupPVCNamespace: "pulp",
+				BackupDir:          "/backups/openshift-backup-2022-12-01",
+			},
+		},
+		{
+			name: "from pvc",
+			spec: AnsibleRestoreSpec{
+				DeploymentName: "example-pulp",
+				BackupSource:   "PVC",
+				BackupPVC:      "backups",
+				BackupDir:      "/backups/openshift-backup-2022-11-01",
+			},
+			expected: repomanagerv1alpha1.PulpRestoreSpec{
+				DeploymentType: "pulp",
+				DeploymentName: "example-pulp",
+				BackupSource:   "PVC",
+				BackupPVC:      "backups",
+				BackupDir:      "/backups/openshift-backup-2022-11-01",
+			},
+		},
+		{
+			name: "backup not found",
+			spec: AnsibleRestoreSpec{DeploymentName: "example-pulp", BackupName: "removed"},
+			expected: repomanagerv1alpha1.PulpRestoreSpec{
+				DeploymentType: "pulp",
+				DeploymentName: "example-pulp",
+				BackupName:     "removed",
+			},
+			wantWarnings: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec, warnings := ConvertRestore(tt.spec, tt.backup, pulp)
+			if !reflect.DeepEqual(spec, tt.expected) {
+				t.Errorf("ConvertRestore() = %+v, expected %+v", spec, tt.expected)
+			}
+			if len(warnings) != tt.wantWarnings {
+				t.Errorf("ConvertRestore() warnings = %v, expected %d", warnings, tt.wantWarnings)
+			}
+		})
+	}
+}
+
+func TestBackupStatus(t *testing.T) {
+	tests := []struct {
+		name          string
+		status        AnsibleBackupStatus
+		wantCompleted bool
+		wantFailed    bool
+	}{
+		{"new", AnsibleBackupStatus{}, false, false},
+		{"running", AnsibleBackupStatus{Conditions: []AnsibleCondition{{Type: "Running", Status: "True"}}}, false, false},
+		{"successful", AnsibleBackupStatus{
+			BackupDirectory: "/backups/openshift-backup-2022-12-01",
+			Conditions:      []AnsibleCondition{{Type: "Successful", Status: "True"}},
+		}, true, false},
+		// the status is updated at the end of every reconciliation
+		{"successful without directory", AnsibleBackupStatus{Conditions: []AnsibleCondition{{Type: "Successful", Status: "True"}}}, false, false},
+		{"failed", AnsibleBackupStatus{Conditions: []AnsibleCondition{{Type: "Failure", Status: "True"}}}, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if completed := tt.status.Completed(); completed != tt.wantCompleted {
+				t.Errorf("Completed() = %v, expected %v", completed, tt.wantCompleted)
+			}
+			if failed := tt.status.Failed(); failed != tt.wantFailed {
+				t.Errorf("Failed() = %v, expected %v", failed, tt.wantFailed)
+			}
+		})
+	}
+}
+
+func TestRestoreCompleted(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   AnsibleRestoreStatus
+		expected bool
+	}{
+		{"new", AnsibleRestoreStatus{}, false},
+		{"running", AnsibleRestoreStatus{Conditions: []AnsibleCondition{{Type: "Running", Status: "True"}}}, false},
+		{"successful", AnsibleRestoreStatus{Conditions: []AnsibleCondition{{Type: "Successful", Status: "True"}}}, true},
+		{"restore complete", AnsibleRestoreStatus{RestoreComplete: true}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if completed := tt.status.Completed(); completed != tt.expected {
+				t.Errorf("Completed() = %v, expected %v", completed, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,448 @@
+// Package conversion maps the spec of an ansible Pulp CR (pulp.pulpproject.org)
+// into the spec of a golang Pulp CR (repo-manager.pulpproject.org).
+// It does not talk to the cluster, everything that should be discovered
+// from it is provided through ClusterInfo.
+package conversion
+
+import (
+	"fmt"
+	"reflect"
+
+	repomanagerv1alpha1 "github.com/pulp/pulp-operator/api/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// ClusterInfo holds the values discovered in the cluster that are
+// needed to build the golang Pulp CR spec.
+type ClusterInfo struct {
+	// ResourceName is the name of the ansible Pulp CR
+	ResourceName string
+
+	// Namespace is the namespace of the ansible Pulp CR
+	Namespace string
+
+	// DBPVC is the name of the PVC used by the current database pods
+	DBPVC string
+
+	// IngressDomain is the cluster default ingress domain, used to build
+	// the route host when ingress_type is route and no route_host was provided
+	IngressDomain string
+
+	// ExternalDBSecret is the name of the secret (in the golang operator
+	// format) with the credentials of an external database, if any
+	ExternalDBSecret string
+
+	// RedisPVC is the name of the PVC used by the current redis pod
+	RedisPVC string
+
+	// ExternalCacheSecret is the name of the secret (in the golang operator
+	// format) with the credentials of an external Redis, if any
+	ExternalCacheSecret string
+
+	// DBUser is the user of the current database, from the ansible
+	// postgres configuration secret
+	DBUser string
+
+	// Endpoint is the Route or Ingress created by the ansible operator, if
+	// it was found. Its settings are kept over the ones in the spec.
+	Endpoint *Endpoint
+}
+
+// Endpoint holds the settings of the live Route or Ingress that exposes
+// the ansible installation
+type Endpoint struct {
+	// Kind is Route or Ingress
+	Kind string
+	Name string
+	Host string
+
+	// TLSTermination is the termination of the Route (edge, passthrough
+	// or reencrypt) and TLSCertificate is true if it has its own certificate
+	TLSTermination string
+	TLSCertificate bool
+
+	// TLSSecret and IngressClassName are the certificate secret and the
+	// class of the Ingress
+	TLSSecret        string
+	IngressClassName string
+}
+
+// Convert returns the golang Pulp CR spec equivalent to the ansible one and
+// a list of warnings about the settings that could not be carried over.
+func Convert(spec AnsibleSpec, cluster ClusterInfo) (repomanagerv1alpha1.PulpSpec, []string) {
+	warnings := droppedFields(spec, cluster)
+
+	affinity := (*corev1.Affinity)(nil)
+	if spec.Affinity != nil && spec.Affinity.NodeAffinity != nil {
+		affinity = &corev1.Affinity{NodeAffinity: spec.Affinity.NodeAffinity}
+	}
+	nodeSelector, err := parseNodeSelector(spec.NodeSelector)
+	if err != nil {
+		warnings = append(warnings, "node_selector: "+err.Error()+", it will not be migrated")
+	}
+	if affinity != nil {
+		warnings = append(warnings, "affinity: golang operator does not support affinity for web pods, it will be applied only to api, content, worker, database and cache pods")
+	}
+
+	// postgres_selector has precedence over node_selector for the database pods
+	dbNodeSelector := nodeSelector
+	if len(spec.PostgresSelector) > 0 {
+		if selector, err := parseNodeSelector(spec.PostgresSelector); err != nil {
+			warnings = append(warnings, "postgres_selector: "+err.Error()+", it will not be migrated")
+		} else {
+			dbNodeSelector = selector
+		}
+	}
+	dbTolerations, err := parseTolerations(spec.PostgresToleration)
+	if err != nil {
+		warnings = append(warnings, "postgres_tolerations: "+err.Error()+", it will not be migrated")
+	}
+	if len(spec.PostgresLabelSelector) > 0 {
+		if _, err := labels.Parse(spec.PostgresLabelSelector); err != nil {
+			warnings = append(warnings, fmt.Sprintf("postgres_label_selector: invalid label selector %q, it will not be migrated", spec.PostgresLabelSelector))
+		} else {
+			warnings = append(warnings, "postgres_label_selector: golang operator identifies the database pods through its own labels (app=postgresql,pulp_cr=<name>), it will not be migrated")
+		}
+	}
+
+	apiResources := corev1.ResourceRequirements{}
+	if spec.Api.ResourceRequirements != nil {
+		apiResources = *spec.Api.ResourceRequirements
+	}
+	contentResources := corev1.ResourceRequirements{}
+	if spec.Content.ResourceRequirements != nil {
+		contentResources = *spec.Content.ResourceRequirements
+	}
+	workerResources := corev1.ResourceRequirements{}
+	if spec.Worker.ResourceRequirements != nil {
+		workerResources = *spec.Worker.ResourceRequirements
+	}
+	webResources := corev1.ResourceRequirements{}
+	if spec.Web.ResourceRequirements != nil {
+		webResources = *spec.Web.ResourceRequirements
+	}
+	dbResources := corev1.ResourceRequirements{}
+	if spec.PostgresResourceRequirements != nil {
+		dbResources = *spec.PostgresResourceRequirements
+	}
+
+	// golang operator expects only the storage size of the database PVC
+	dbStorageRequirements := ""
+	if spec.PostgresStorageRequirements != nil {
+		if storage, found := spec.PostgresStorageRequirements.Requests[corev1.ResourceStorage]; found {
+			dbStorageRequirements = storage.String()
+		}
+	}
+
+	apiStrategy := appsv1.DeploymentStrategy{}
+	if spec.Api.Strategy != nil {
+		apiStrategy = *spec.Api.Strategy
+	}
+	contentStrategy := appsv1.DeploymentStrategy{}
+	if spec.Content.Strategy != nil {
+		contentStrategy = *spec.Content.Strategy
+	}
+	workerStrategy := appsv1.DeploymentStrategy{}
+	if spec.Worker.Strategy != nil {
+		workerStrategy = *spec.Worker.Strategy
+	}
+	cacheStrategy := appsv1.DeploymentStrategy{}
+	if spec.Redis.Strategy != nil {
+		cacheStrategy = *spec.Redis.Strategy
+	}
+	// redis_resource_requirements is deprecated in favor of redis.resource_requirements
+	cacheResourceRequirements := spec.RedisResourceRequirements
+	if spec.Redis.ResourceRequirements != nil {
+		cacheResourceRequirements = *spec.Redis.ResourceRequirements
+	}
+
+	imagePullSecrets := spec.ImagePullSecrets
+	if spec.ImagePullSecret != "" {
+		imagePullSecrets = append(imagePullSecrets, spec.ImagePullSecret)
+	}
+
+	pulpPVC := ""
+	if len(spec.ObjectStorageAzureSecret) == 0 && len(spec.ObjectStorageS3Secret) == 0 {
+		pulpPVC = cluster.ResourceName + "-file-storage"
+	}
+
+	// Defining file_storage_class as "" to avoid conflict with pvc definition.
+	// In go version we are verifying multiple storage definitions,
+	// in ansible, when none of s3 or azure blob secrets are provided, the operator
+	// will provision a PVC. If a SC is provided, it will define the PVC spec with it,
+	// if not, no SC will be defined and k8s will try to use an available PV that fits
+	// the spec of the PVC.
+	fileStorageClass := ""
+	cacheStorageClass := ""
+	// without a PVC to reuse, golang operator provisions a new one
+	if len(cluster.RedisPVC) == 0 {
+		cacheStorageClass = spec.RedisStorageClass
+	}
+	dbStorageClass := (*string)(nil)
+
+	// Rolling back this
+	/*
+		It is possible to set deployment_type: pulp, but deploy galaxy images (which is the default behavior, in both operators, when deployment_type is not provided).
+		The readiness and liveness probe from postgres sts is defined with a user based on deployment_type.
+		This is causing the following error when running migrator:
+		2023-01-03 18:24:06.002 UTC [456] FATAL:  password authentication failed for user "galaxy"
+		2023-01-03 18:24:06.002 UTC [456] DETAIL:  Role "galaxy" does not exist.
+				Connection matched pg_hba.conf line 90: "host	all         	all         	127.0.0.1/32        	scram-sha-256"
+		2023-01-03 18:24:15.990 UTC [474] FATAL:  password authentication failed for user "galaxy"
+		2023-01-03 18:24:15.990 UTC [474] DETAIL:  Role "galaxy" does not exist.
+				Connection matched pg_hba.conf line 90: "host	all         	all         	127.0.0.1/32        	scram-sha-256"
+		2023-01-03 18:24:16.002 UTC [475] FATAL:  password authentication failed for user "galaxy"
+		2023-01-03 18:24:16.002 UTC [475] DETAIL:  Role "galaxy" does not exist.
+				Connection matched pg_hba.conf line 90: "host	all         	all         	127.0.0.1/32        	scram-sha-256"
+	*/
+	/* deploymentType := "pulp"
+	if isGalaxy, _ := regexp.MatchString(".*galaxy.*", spec.Image); isGalaxy {
+		deploymentType = "galaxy"
+	} */
+	deploymentType := spec.DeploymentType
+
+	routeHost := spec.RouteHost
+	ingressHost, ingressTLSSecret, ingressClassName := "", spec.IngressTLSSecret, ""
+	if endpoint := cluster.Endpoint; endpoint != nil && endpoint.Kind == "Route" {
+		routeHost = endpoint.Host
+		warnings = append(warnings, routeWarnings(spec, *endpoint)...)
+	} else if endpoint != nil && endpoint.Kind == "Ingress" {
+		ingressHost, ingressClassName = endpoint.Host, endpoint.IngressClassName
+		if len(endpoint.TLSSecret) > 0 {
+			ingressTLSSecret = endpoint.TLSSecret
+		}
+		warnings = append(warnings, ingressWarnings(spec, *endpoint)...)
+	} else if spec.IngressType == "route" && len(spec.RouteHost) == 0 {
+		if len(cluster.IngressDomain) > 0 {
+			routeHost = cluster.ResourceName + "-" + cluster.Namespace + "." + cluster.IngressDomain
+		} else {
+			warnings = append(warnings, "route_host: not defined and the cluster ingress domain is unknown, golang operator will define a default one")
+		}
+	}
+
+	if len(cluster.DBPVC) == 0 && len(cluster.ExternalDBSecret) == 0 {
+		warnings = append(warnings, "database.pvc: the current database PVC is unknown, golang operator will provision a new one")
+	}
+
+	if len(cluster.RedisPVC) == 0 && len(cluster.ExternalCacheSecret) == 0 {
+		warnings = append(warnings, "cache.pvc: the current redis PVC is unknown, golang operator will provision a new one")
+	}
+	if IsCacheDisabled(spec.PulpSettings) {
+		warnings = append(warnings, "pulp_settings.cache_enabled: golang operator will still deploy a redis pod, but the cache is kept disabled through pulp_settings")
+	}
+
+	pulpSpec := repomanagerv1alpha1.PulpSpec{
+		DeploymentType:           deploymentType,
+		FileStorageSize:          spec.FileStorageSize,
+		FileStorageAccessMode:    spec.FileStorageAccessMode,
+		FileStorageClass:         fileStorageClass,
+		PVC:                      pulpPVC,
+		ObjectStorageAzureSecret: spec.ObjectStorageAzureSecret,
+		ObjectStorageS3Secret:    spec.ObjectStorageS3Secret,
+		DBFieldsEncryptionSecret: spec.DBFieldsEncryptionSecret,
+		SigningSecret:            spec.SigningSecret,
+		SigningScriptsConfigmap:  spec.SigningScriptsConfigmap,
+		StorageType:              spec.StorageType,
+		IngressType:              spec.IngressType,
+		IngressAnnotations:       spec.IngressAnnotations,
+		IngressClassName:         ingressClassName,
+		IngressHost:              ingressHost,
+		IngressTLSSecret:         ingressTLSSecret,
+		RouteHost:                routeHost,
+		RouteTLSSecret:           spec.RouteTLSSecret,
+		HAProxyTimeout:           spec.HAProxyTimeout,
+		NginxMaxBodySize:         spec.NginxMaxBodySize,
+		NginxProxyBodySize:       spec.NginxMaxBodySize,
+		NginxProxyReadTimeout:    spec.NginxProxyReadTimeout,
+		NginxProxyConnectTimeout: spec.NginxProxyConnectTimeout,
+		NginxProxySendTimeout:    spec.NginxProxySendTimeout,
+		ContainerTokenSecret:     spec.ContainerTokenSecret,
+		Image:                    spec.Image,
+		ImageVersion:             spec.ImageVersion,
+		ImagePullPolicy:          spec.ImagePullPolicy,
+		PulpSettings:             spec.PulpSettings,
+		ImageWeb:                 spec.ImageWeb,
+		ImageWebVersion:          spec.ImageWebVersion,
+		AdminPasswordSecret:      spec.AdminPasswordSecret,
+		ImagePullSecrets:         imagePullSecrets,
+		SSOSecret:                spec.SSOSecret,
+		Api: repomanagerv1alpha1.Api{
+			Replicas:                  spec.Api.Replicas,
+			Tolerations:               spec.Tolerations,
+			TopologySpreadConstraints: spec.TopologySpreadConstraints,
+			GunicornTimeout:           spec.GunicornTimeout,
+			GunicornWorkers:           spec.GunicornAPIWorkers,
+			ResourceRequirements:      apiResources,
+			ReadinessProbe:            nil,
+			LivenessProbe:             nil,
+			PDB:                       nil,
+			Strategy:                  apiStrategy,
+			Affinity:                  affinity,
+			NodeSelector:              nodeSelector,
+		},
+		Content: repomanagerv1alpha1.Content{
+			Replicas:                  spec.Content.Replicas,
+			Tolerations:               spec.Tolerations,
+			TopologySpreadConstraints: spec.TopologySpreadConstraints,
+			GunicornTimeout:           spec.GunicornTimeout,
+			GunicornWorkers:           spec.GunicornContentWorkers,
+			ResourceRequirements:      contentResources,
+			ReadinessProbe:            nil,
+			LivenessProbe:             nil,
+			PDB:                       nil,
+			Strategy:                  contentStrategy,
+			Affinity:                  affinity,
+			NodeSelector:              nodeSelector,
+		},
+		Worker: repomanagerv1alpha1.Worker{
+			Replicas:                  spec.Worker.Replicas,
+			Tolerations:               spec.Tolerations,
+			TopologySpreadConstraints: spec.TopologySpreadConstraints,
+			ResourceRequirements:      workerResources,
+			ReadinessProbe:            nil,
+			LivenessProbe:             nil,
+			PDB:                       nil,
+			Strategy:                  workerStrategy,
+			Affinity:                  affinity,
+			NodeSelector:              nodeSelector,
+		},
+		Web: repomanagerv1alpha1.Web{
+			Replicas:             spec.Web.Replicas,
+			ResourceRequirements: webResources,
+			ReadinessProbe:       nil,
+			LivenessProbe:        nil,
+			PDB:                  nil,
+			NodeSelector:         nodeSelector,
+		},
+		Database: repomanagerv1alpha1.Database{
+			Affinity:                    affinity,
+			NodeSelector:                dbNodeSelector,
+			Tolerations:                 dbTolerations,
+			PostgresImage:               spec.PostgresImage,
+			PostgresExtraArgs:           spec.PostgresExtraArgs,
+			PostgresDataPath:            spec.PostgresDataPath,
+			PostgresInitdbArgs:          spec.PostgresInitdbArgs,
+			PostgresHostAuthMethod:      spec.PostgresHostAuthMethod,
+			ResourceRequirements:        dbResources,
+			PostgresStorageRequirements: dbStorageRequirements,
+			PostgresStorageClass:        dbStorageClass,
+			ReadinessProbe:              nil,
+			LivenessProbe:               nil,
+			PVC:                         cluster.DBPVC,
+			//ExternalDBSecret: "",
+			//PostgresVersion: "",
+			//PostgresPort: 5432,
+			//PostgresSSLMode: "prefer",
+		},
+		Cache: repomanagerv1alpha1.Cache{
+			RedisImage:                spec.RedisImage,
+			RedisStorageClass:         cacheStorageClass,
+			RedisResourceRequirements: cacheResourceRequirements,
+			ReadinessProbe:            nil,
+			LivenessProbe:             nil,
+			Affinity:                  affinity,
+			Tolerations:               nil,
+			NodeSelector:              nodeSelector,
+			Strategy:                  cacheStrategy,
+			PVC:                       cluster.RedisPVC,
+			Enabled:                   true,
+			//RedisPort: 6379,
+		},
+	}
+
+	// golang operator checks the database pods with a user named after the
+	// deployment_type, which does not exist if the database was created
+	// with another one (for example, a galaxy deployment with a pulp user)
+	if probe := dbProbe(cluster.DBUser, deploymentType); probe != nil {
+		pulpSpec.Database.ReadinessProbe = probe
+		pulpSpec.Database.LivenessProbe = probe.DeepCopy()
+	}
+
+	// the database is not deployed by the operator, so none of the settings
+	// of the managed database pods apply
+	if len(cluster.ExternalDBSecret) > 0 {
+		if !reflect.DeepEqual(pulpSpec.Database, repomanagerv1alpha1.Database{ResourceRequirements: corev1.ResourceRequirements{}}) {
+			warnings = append(warnings, "postgres_*: the database is external, the settings of the managed database will not be migrated")
+		}
+		pulpSpec.Database = repomanagerv1alpha1.Database{ExternalDBSecret: cluster.ExternalDBSecret}
+	}
+
+	// same for an external Redis
+	if len(cluster.ExternalCacheSecret) > 0 {
+		if len(spec.RedisImage) > 0 || spec.Redis != (Redis{}) || !reflect.DeepEqual(spec.RedisResourceRequirements, corev1.ResourceRequirements{}) {
+			warnings = append(warnings, "redis_*: the cache is external, the settings of the managed redis will not be migrated")
+		}
+		pulpSpec.Cache = repomanagerv1alpha1.Cache{Enabled: true, ExternalCacheSecret: cluster.ExternalCacheSecret}
+	}
+
+	return pulpSpec, warnings
+}
+
+// dbProbe returns a probe checking the database with user, or nil if the
+// probe defined by golang operator (with a user named after the
+// deployment_type) can be used
+func dbProbe(user, deploymentType string) *corev1.Probe {
+	if deploymentType == "" {
+		deploymentType = "pulp"
+	}
+	if user == "" || user == deploymentType {
+		return nil
+	}
+	return &corev1.Probe{
+		ProbeHandler: corev1.ProbeHandler{
+			Exec: &corev1.ExecAction{
+				Command: []string{"/bin/sh", "-i", "-c", "pg_isready -U " + user + " -h 127.0.0.1 -p 5432"},
+			},
+		},
+		InitialDelaySeconds: 20,
+		PeriodSeconds:       10,
+		TimeoutSeconds:      5,
+		FailureThreshold:    6,
+		SuccessThreshold:    1,
+	}
+}
+
+// droppedFields returns a warning for each ansible field that is defined
+// but is not carried over to the golang Pulp CR.
+func droppedFields(spec AnsibleSpec, cluster ClusterInfo) []string {
+	const notSupported = "not supported by golang operator"
+	const pvcReused = "the existing PVC is reused"
+
+	fields := []struct {
+		name    string
+		defined bool
+		reason  string
+	}{
+		{"api.log_level", len(spec.Api.LogLevel) > 0, notSupported},
+		{"content.log_level", len(spec.Content.LogLevel) > 0, notSupported},
+		{"file_storage_storage_class", len(spec.FileStorageClass) > 0, pvcReused},
+		{"hostname", len(spec.Hostname) > 0, notSupported},
+		{"loadbalancer_port", spec.LoadbalancerPort != 0, notSupported},
+		{"loadbalancer_protocol", len(spec.LoadBalancerProtocol) > 0, notSupported},
+		// true is the default of the ansible CRD
+		{"no_log", spec.NoLog != nil && !*spec.NoLog, notSupported},
+		{"nodeport_port", len(spec.NodePort) > 0, notSupported},
+		{"postgres_configuration_secret", len(spec.PostgresConfigurationSecret) > 0 && len(cluster.ExternalDBSecret) == 0, "golang operator manages the credentials of its database"},
+		{"postgres_keep_pvc_after_upgrade", spec.PostgresKeepPVCAfterUpgrade, notSupported},
+		{"postgres_migrant_configuration_secret", len(spec.PostgresMigrantConfigurationSecret) > 0, notSupported},
+		{"postgres_storage_class", spec.PostgresStorageClass != nil, pvcReused},
+		{"redis.log_level", len(spec.Redis.LogLevel) > 0, notSupported},
+		{"redis.replicas", spec.Redis.Replicas > 1, "golang operator deploys a single redis pod"},
+		{"redis_resource_requirements", spec.Redis.ResourceRequirements != nil && !reflect.DeepEqual(spec.RedisResourceRequirements, corev1.ResourceRequirements{}), "redis.resource_requirements is used instead"},
+		{"redis_storage_class", len(spec.RedisStorageClass) > 0 && len(cluster.RedisPVC) > 0, pvcReused},
+		{"resource_manager", spec.ResourceManager != (ResourceManager{}), "golang operator does not deploy a resource manager"},
+		{"route_tls_termination_mechanism", len(spec.RouteTLSTerminationMechanism) > 0, "golang operator always creates edge routes"},
+		{"service_annotations", len(spec.ServiceAnnotations) > 0, notSupported},
+		{"web.strategy", spec.Web.Strategy != nil, notSupported},
+	}
+
+	warnings := []string{}
+	for _, field := range fields {
+		if field.defined {
+			warnings = append(warnings, field.name+": "+field.reason+", it will not be migrated")
+		}
+	}
+	return warnings
+}
@@ -0,0 +1,276 @@
+package conversion
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	repomanagerv1alpha1 "github.com/pulp/pulp-operator/api/v1alpha1"
+	"sigs.k8s.io/yaml"
+)
+
+var update = flag.Bool("update", false, "update the golden files")
+
+// golden is the content of the testdata/*.golden.yaml files
+type golden struct {
+	Spec     repomanagerv1alpha1.PulpSpec `json:"spec"`
+	Warnings []string                     `json:"warnings"`
+	Report   Report                       `json:"report"`
+}
+
+func TestConvert(t *testing.T) {
+	tests := []struct {
+		name    string
+		galaxy  bool
+		cluster ClusterInfo
+	}{
+		{
+			name: "full",
+			cluster: ClusterInfo{
+				ResourceName:  "example-pulp",
+				Namespace:     "pulp",
+				DBPVC:         "postgres-example-pulp-postgres-13-0",
+				IngressDomain: "apps.example.com",
+				RedisPVC:      "example-pulp-redis-data",
+			},
+		},
+		{
+			name: "minimal",
+			cluster: ClusterInfo{
+				ResourceName:  "example-pulp",
+				Namespace:     "pulp",
+				DBPVC:         "postgres-example-pulp-postgres-13-0",
+				IngressDomain: "apps.example.com",
+				RedisPVC:      "example-pulp-redis-data",
+			},
+		},
+		{
+			name: "invalid-scheduling",
+			cluster: ClusterInfo{
+				ResourceName: "example-pulp",
+				Namespace:    "pulp",
+				DBPVC:        "postgres-example-pulp-postgres-13-0",
+				RedisPVC:     "example-pulp-redis-data",
+			},
+		},
+		{
+			name: "object-storage",
+			cluster: ClusterInfo{
+				ResourceName: "example-pulp",
+				Namespace:    "pulp",
+			},
+		},
+		{
+			name: "external-database",
+			cluster: ClusterInfo{
+				ResourceName:     "example-pulp",
+				Namespace:        "pulp",
+				ExternalDBSecret: "example-pulp-external-database",
+				RedisPVC:         "example-pulp-redis-data",
+			},
+		},
+		{
+			name:   "galaxy",
+			galaxy: true,
+			cluster: ClusterInfo{
+				ResourceName:  "galaxy",
+				Namespace:     "galaxy",
+				DBPVC:         "postgres-galaxy-postgres-13-0",
+				RedisPVC:      "galaxy-redis-data",
+				IngressDomain: "apps.example.com",
+				DBUser:        "pulp",
+			},
+		},
+		{
+			name: "external-cache",
+			cluster: ClusterInfo{
+				ResourceName:        "example-pulp",
+				Namespace:           "pulp",
+				DBPVC:               "postgres-example-pulp-postgres-13-0",
+				ExternalCacheSecret: "example-pulp-external-cache",
+			},
+		},
+		{
+			name: "live-route",
+			cluster: ClusterInfo{
+				ResourceName:  "example-pulp",
+				Namespace:     "pulp",
+				DBPVC:         "postgres-example-pulp-postgres-13-0",
+				IngressDomain: "apps.example.com",
+				RedisPVC:      "example-pulp-redis-data",
+				Endpoint: &Endpoint{
+					Kind:           "Route",
+					Name:           "example-pulp",
+					Host:           "pulp.example.com",
+					TLSTermination: "passthrough",
+					TLSCertificate: true,
+				},
+			},
+		},
+		{
+			name: "live-ingress",
+			cluster: ClusterInfo{
+				ResourceName: "example-pulp",
+				Namespace:    "pulp",
+				DBPVC:        "postgres-example-pulp-postgres-13-0",
+				RedisPVC:     "example-pulp-redis-data",
+				Endpoint: &Endpoint{
+					Kind:             "Ingress",
+					Name:             "example-pulp-ingress",
+					Host:             "pulp.example.org",
+					TLSSecret:        "example-pulp-ingress-tls",
+					IngressClassName: "nginx",
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec := readSpec(t, filepath.Join("testdata", tt.name+".yaml"))
+
+			got := golden{}
+			convert := Convert
+			if tt.galaxy {
+				convert = ConvertGalaxy
+			}
+			got.Spec, got.Warnings = convert(spec, tt.cluster)
+			got.Report = NewReport(spec, got.Spec, got.Warnings)
+			out, err := yaml.Marshal(got)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			goldenFile := filepath.Join("testdata", tt.name+".golden.yaml")
+			if *update {
+				if err := os.WriteFile(goldenFile, out, 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			expected, err := os.ReadFile(goldenFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(out, expected) {
+				t.Errorf("conversion of %s differs from %s (run go test ./conversion -update to regenerate it):\n%s", tt.name, goldenFile, out)
+			}
+		})
+	}
+}
+
+// TestNoLog verifies that no_log is only reported as dropped (with a warning)
+// when it is set to false, true being what the golang operator does
+func TestNoLog(t *testing.T) {
+	yes, no := true, false
+	tests := []struct {
+		name    string
+		noLog   *bool
+		fate    Fate
+		warning bool
+	}{
+		{"true", &yes, Ignored, false},
+		{"false", &no, Dropped, true},
+		{"unset", nil, "", false},
+	}
+	for _, tt := range tests {
+		spec := AnsibleSpec{NoLog: tt.noLog, IngressType: "route"}
+		pulpSpec, warnings := Convert(spec, ClusterInfo{ResourceName: "example-pulp", Namespace: "pulp"})
+		warned, _ := warningFor("no_log", warnings)
+		if (warned != "") != tt.warning {
+			t.Errorf("no_log %s: warnings = %v, expected a warning %v", tt.name, warnings, tt.warning)
+		}
+		fate := Fate("")
+		for _, field := range NewReport(spec, pulpSpec, warnings).Fields {
+			if field.Field == "no_log" {
+				fate = field.Fate
+			}
+		}
+		if fate != tt.fate {
+			t.Errorf("no_log %s: report fate = %q, expected %q", tt.name, fate, tt.fate)
+		}
+	}
+}
+
+// TestFullCoversCRD makes sure that testdata/full.yaml defines every field
+// from the ansible Pulp CRD, so the golden files cover all of them.
+func TestFullCoversCRD(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("..", "crd.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	crd := map[string]any{}
+	if err := yaml.Unmarshal(data, &crd); err != nil {
+		t.Fatal(err)
+	}
+	schema := lookup(crd, "spec", "versions")
+	versions, _ := schema.([]any)
+	if len(versions) == 0 {
+		t.Fatal("no versions found in crd.yaml")
+	}
+	specSchema := lookup(versions[0], "schema", "openAPIV3Schema", "properties", "spec")
+
+	data, err = os.ReadFile(filepath.Join("testdata", "full.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	full := map[string]any{}
+	if err := yaml.Unmarshal(data, &full); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range properties(specSchema, nil) {
+		if lookup(full, path...) == nil {
+			t.Errorf("field %v from crd.yaml is not defined in testdata/full.yaml", path)
+		}
+	}
+}
+
+// readSpec decodes an ansible Pulp CR spec from a yaml file
+func readSpec(t *testing.T, file string) AnsibleSpec {
+	t.Helper()
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	spec := AnsibleSpec{}
+	if err := yaml.Unmarshal(data, &spec); err != nil {
+		t.Fatal(err)
+	}
+	return spec
+}
+
+// lookup returns the value found in obj following the keys in path
+// or nil if any of them does not exist
+func lookup(obj any, path ...string) any {
+	for _, key := range path {
+		m, ok := obj.(map[string]any)
+		if !ok {
+			return nil
+		}
+		if obj, ok = m[key]; !ok {
+			return nil
+		}
+	}
+	return obj
+}
+
+// properties returns the path of every property declared in an openAPIV3Schema
+func properties(schema any, parent []string) [][]string {
+	props, _ := lookup(schema, "properties").(map[string]any)
+	names := []string{}
+	for name := range props {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	paths := [][]string{}
+	for _, name := range names {
+		path := append(append([]string{}, parent...), name)
+		paths = append(paths, path)
+		paths = append(paths, properties(props[name], path)...)
+	}
+	return paths
+}
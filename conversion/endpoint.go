@@ -0,0 +1,42 @@
+package conversion
+
+import (
+	"fmt"
+	"strings"
+)
+
+// routeWarnings reports the differences between the spec and the live Route,
+// whose settings are carried over
+func routeWarnings(spec AnsibleSpec, route Endpoint) []string {
+	warnings := []string{}
+	if len(spec.RouteHost) > 0 && spec.RouteHost != route.Host {
+		warnings = append(warnings, fmt.Sprintf("route_host: the live route %s uses %q, it is kept instead of %q", route.Name, route.Host, spec.RouteHost))
+	}
+	// golang operator always creates edge routes
+	termination := strings.ToLower(route.TLSTermination)
+	if len(termination) > 0 && termination != "edge" {
+		warnings = append(warnings, fmt.Sprintf("route_tls_termination_mechanism: the live route %s uses %s termination, golang operator will create an edge route", route.Name, termination))
+	} else if len(termination) > 0 && len(spec.RouteTLSTerminationMechanism) > 0 && !strings.EqualFold(spec.RouteTLSTerminationMechanism, termination) {
+		warnings = append(warnings, fmt.Sprintf("route_tls_termination_mechanism: the live route %s uses %s termination instead of %s", route.Name, termination, spec.RouteTLSTerminationMechanism))
+	}
+	if route.TLSCertificate && len(spec.RouteTLSSecret) == 0 {
+		warnings = append(warnings, fmt.Sprintf("route_tls_secret: the live route %s has its own certificate, but no route_tls_secret is defined, golang operator will use the default certificate of the router", route.Name))
+	}
+	return warnings
+}
+
+// ingressWarnings reports the differences between the spec and the live
+// Ingress, whose settings are carried over
+func ingressWarnings(spec AnsibleSpec, ingress Endpoint) []string {
+	warnings := []string{}
+	if len(spec.Hostname) > 0 && spec.Hostname != ingress.Host {
+		warnings = append(warnings, fmt.Sprintf("hostname: the live ingress %s uses %q instead of %q, it is kept in ingress_host", ingress.Name, ingress.Host, spec.Hostname))
+	}
+	if len(spec.IngressTLSSecret) > 0 && len(ingress.TLSSecret) > 0 && spec.IngressTLSSecret != ingress.TLSSecret {
+		warnings = append(warnings, fmt.Sprintf("ingress_tls_secret: the live ingress %s uses %q, it is kept instead of %q", ingress.Name, ingress.TLSSecret, spec.IngressTLSSecret))
+	}
+	if len(spec.IngressTLSSecret) > 0 && len(ingress.TLSSecret) == 0 {
+		warnings = append(warnings, fmt.Sprintf("ingress_tls_secret: the live ingress %s has no TLS secret, %q is kept", ingress.Name, spec.IngressTLSSecret))
+	}
+	return warnings
+}
@@ -0,0 +1,33 @@
+package conversion
+
+import (
+	repomanagerv1alpha1 "github.com/pulp/pulp-operator/api/v1alpha1"
+)
+
+// galaxy-operator defaults, used when the Galaxy CR does not define them
+const (
+	galaxyImage    = "quay.io/ansible/galaxy-ng"
+	galaxyImageWeb = "quay.io/ansible/galaxy-ui"
+)
+
+// ConvertGalaxy returns the golang Pulp CR spec equivalent to an ansible
+// Galaxy CR (galaxy.ansible.com). The Galaxy CR shares the schema of the
+// ansible Pulp CR, but it always deploys galaxy images.
+func ConvertGalaxy(spec AnsibleSpec, cluster ClusterInfo) (repomanagerv1alpha1.PulpSpec, []string) {
+	warnings := []string{}
+	if len(spec.DeploymentType) > 0 && spec.DeploymentType != "galaxy" {
+		warnings = append(warnings, "deployment_type: a Galaxy CR always deploys galaxy, "+spec.DeploymentType+" will be replaced by galaxy")
+	}
+	spec.DeploymentType = "galaxy"
+
+	// golang operator defaults to the pulp images
+	if len(spec.Image) == 0 {
+		spec.Image = galaxyImage
+	}
+	if len(spec.ImageWeb) == 0 {
+		spec.ImageWeb = galaxyImageWeb
+	}
+
+	pulpSpec, convertWarnings := Convert(spec, cluster)
+	return pulpSpec, append(warnings, convertWarnings...)
+}
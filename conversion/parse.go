@@ -0,0 +1,56 @@
+package conversion
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// parseNodeSelector converts the ansible node_selector string (a yaml
+// dictionary, usually one "key: value" per line) into the map expected by
+// the golang operator
+func parseNodeSelector(nodeSelector string) (map[string]string, error) {
+	if len(nodeSelector) == 0 {
+		return nil, nil
+	}
+
+	labels := map[string]any{}
+	if err := yaml.Unmarshal([]byte(nodeSelector), &labels); err != nil {
+		return nil, fmt.Errorf("failed to parse %q as a dictionary of labels", nodeSelector)
+	}
+
+	selector := map[string]string{}
+	for key, value := range labels {
+		switch v := value.(type) {
+		case string:
+			selector[key] = v
+		case bool, float64:
+			// unquoted label values like true or 1 are not parsed as strings
+			selector[key] = fmt.Sprint(v)
+		case nil:
+			selector[key] = ""
+		default:
+			return nil, fmt.Errorf("invalid value for label %q in %q", key, nodeSelector)
+		}
+	}
+	return selector, nil
+}
+
+// parseTolerations converts the ansible tolerations string (a yaml list of
+// tolerations, or a single one) into the list expected by the golang operator
+func parseTolerations(tolerations string) ([]corev1.Toleration, error) {
+	if len(tolerations) == 0 {
+		return nil, nil
+	}
+
+	list := []corev1.Toleration{}
+	if err := yaml.UnmarshalStrict([]byte(tolerations), &list); err == nil {
+		return list, nil
+	}
+	single := corev1.Toleration{}
+	if err := yaml.UnmarshalStrict([]byte(tolerations), &single); err == nil {
+		return []corev1.Toleration{single}, nil
+	}
+	return nil, fmt.Errorf("failed to parse %q as a list of tolerations", tolerations)
+}
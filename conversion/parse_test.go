@@ -0,0 +1,92 @@
+package conversion
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestParseNodeSelector(t *testing.T) {
+	tests := []struct {
+		name         string
+		nodeSelector string
+		expected     map[string]string
+		wantErr      bool
+	}{
+		{name: "empty", nodeSelector: "", expected: nil},
+		{name: "single label", nodeSelector: "disktype: ssd", expected: map[string]string{"disktype": "ssd"}},
+		{
+			name:         "multiple lines",
+			nodeSelector: "disktype: ssd\nkubernetes.io/os: linux\n",
+			expected:     map[string]string{"disktype": "ssd", "kubernetes.io/os": "linux"},
+		},
+		{
+			name:         "inline dictionary",
+			nodeSelector: `{"disktype": "ssd", "node-role.kubernetes.io/infra": ""}`,
+			expected:     map[string]string{"disktype": "ssd", "node-role.kubernetes.io/infra": ""},
+		},
+		{
+			name:         "unquoted values",
+			nodeSelector: "gpu: true\nrack: 7\nempty:",
+			expected:     map[string]string{"gpu": "true", "rack": "7", "empty": ""},
+		},
+		{name: "list", nodeSelector: "- disktype: ssd", wantErr: true},
+		{name: "nested value", nodeSelector: "disktype:\n  ssd: true", wantErr: true},
+		{name: "plain string", nodeSelector: "disktype=ssd", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseNodeSelector(tt.nodeSelector)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestParseTolerations(t *testing.T) {
+	tests := []struct {
+		name        string
+		tolerations string
+		expected    []corev1.Toleration
+		wantErr     bool
+	}{
+		{name: "empty", tolerations: "", expected: nil},
+		{
+			name:        "list",
+			tolerations: "- key: dedicated\n  operator: Equal\n  value: database\n  effect: NoSchedule\n- operator: Exists\n",
+			expected: []corev1.Toleration{
+				{Key: "dedicated", Operator: corev1.TolerationOpEqual, Value: "database", Effect: corev1.TaintEffectNoSchedule},
+				{Operator: corev1.TolerationOpExists},
+			},
+		},
+		{
+			name:        "single toleration",
+			tolerations: "key: dedicated\noperator: Exists\neffect: NoExecute\ntolerationSeconds: 60",
+			expected: []corev1.Toleration{
+				{Key: "dedicated", Operator: corev1.TolerationOpExists, Effect: corev1.TaintEffectNoExecute, TolerationSeconds: &sixty},
+			},
+		},
+		{name: "unknown field", tolerations: "- key: dedicated\n  operater: Exists", wantErr: true},
+		{name: "plain string", tolerations: "dedicated=database:NoSchedule", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseTolerations(tt.tolerations)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+var sixty = int64(60)
@@ -0,0 +1,344 @@
+package conversion
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	repomanagerv1alpha1 "github.com/pulp/pulp-operator/api/v1alpha1"
+)
+
+// Fate is what happened to an ansible field during the conversion
+type Fate string
+
+const (
+	// Mapped fields are copied as is to the golang Pulp CR
+	Mapped Fate = "mapped"
+	// Transformed fields are carried over with a different value or format
+	Transformed Fate = "transformed"
+	// Defaulted fields are not defined in the ansible Pulp CR, the converter
+	// fills them with a value discovered in the cluster or a default
+	Defaulted Fate = "defaulted"
+	// Dropped fields are not carried over to the golang Pulp CR
+	Dropped Fate = "dropped"
+	// Ignored fields are not carried over either, but their value is what
+	// the golang operator does anyway
+	Ignored Fate = "ignored"
+)
+
+// FieldReport describes the fate of a single field
+type FieldReport struct {
+	Field    string   `json:"field,omitempty"`
+	Fate     Fate     `json:"fate"`
+	Targets  []string `json:"targets,omitempty"`
+	OldValue any      `json:"oldValue,omitempty"`
+	NewValue any      `json:"newValue,omitempty"`
+	Reason   string   `json:"reason,omitempty"`
+}
+
+// Report lists every field defined in the ansible Pulp CR (and every field
+// defaulted in the golang Pulp CR) with its fate
+type Report struct {
+	Fields []FieldReport `json:"fields"`
+}
+
+// fieldTargets maps the ansible fields to the golang ones they are converted to
+var fieldTargets = map[string][]string{
+	"admin_password_secret":          {"admin_password_secret"},
+	"affinity":                       {"api.affinity", "content.affinity", "worker.affinity", "database.affinity", "cache.affinity"},
+	"api.replicas":                   {"api.replicas"},
+	"api.resource_requirements":      {"api.resource_requirements"},
+	"api.strategy":                   {"api.strategy"},
+	"container_token_secret":         {"container_token_secret"},
+	"content.replicas":               {"content.replicas"},
+	"content.resource_requirements":  {"content.resource_requirements"},
+	"content.strategy":               {"content.strategy"},
+	"db_fields_encryption_secret":    {"db_fields_encryption_secret"},
+	"deployment_type":                {"deployment_type"},
+	"file_storage_access_mode":       {"file_storage_access_mode"},
+	"file_storage_size":              {"file_storage_size"},
+	"gunicorn_api_workers":           {"api.gunicorn_workers"},
+	"gunicorn_content_workers":       {"content.gunicorn_workers"},
+	"gunicorn_timeout":               {"api.gunicorn_timeout", "content.gunicorn_timeout"},
+	"haproxy_timeout":                {"haproxy_timeout"},
+	"image":                          {"image"},
+	"image_pull_policy":              {"image_pull_policy"},
+	"image_pull_secret":              {"image_pull_secrets"},
+	"image_pull_secrets":             {"image_pull_secrets"},
+	"image_version":                  {"image_version"},
+	"image_web":                      {"image_web"},
+	"image_web_version":              {"image_web_version"},
+	"ingress_annotations":            {"ingress_annotations"},
+	"ingress_tls_secret":             {"ingress_tls_secret"},
+	"ingress_type":                   {"ingress_type"},
+	"nginx_client_max_body_size":     {"nginx_client_max_body_size", "nginx_proxy_body_size"},
+	"nginx_proxy_connect_timeout":    {"nginx_proxy_connect_timeout"},
+	"nginx_proxy_read_timeout":       {"nginx_proxy_read_timeout"},
+	"nginx_proxy_send_timeout":       {"nginx_proxy_send_timeout"},
+	"node_selector":                  {"api.node_selector", "content.node_selector", "worker.node_selector", "web.node_selector", "database.node_selector", "cache.node_selector"},
+	"object_storage_azure_secret":    {"object_storage_azure_secret"},
+	"object_storage_s3_secret":       {"object_storage_s3_secret"},
+	"postgres_configuration_secret":  {"database.external_db_secret"},
+	"postgres_data_path":             {"database.postgres_data_path"},
+	"postgres_extra_args":            {"database.postgres_extra_args"},
+	"postgres_host_auth_method":      {"database.postgres_host_auth_method"},
+	"postgres_image":                 {"database.postgres_image"},
+	"postgres_initdb_args":           {"database.postgres_initdb_args"},
+	"postgres_resource_requirements": {"database.postgres_resource_requirements"},
+	"postgres_selector":              {"database.node_selector"},
+	"postgres_storage_requirements":  {"database.postgres_storage_requirements"},
+	"postgres_tolerations":           {"database.tolerations"},
+	"pulp_settings":                  {"pulp_settings"},
+	"redis.resource_requirements":    {"cache.redis_resource_requirements"},
+	"redis.strategy":                 {"cache.strategy"},
+	"redis_image":                    {"cache.redis_image"},
+	"redis_resource_requirements":    {"cache.redis_resource_requirements"},
+	"redis_storage_class":            {"cache.redis_storage_class"},
+	"route_host":                     {"route_host"},
+	"route_tls_secret":               {"route_tls_secret"},
+	"signing_scripts_configmap":      {"signing_scripts_configmap"},
+	"signing_secret":                 {"signing_secret"},
+	"sso_secret":                     {"sso_secret"},
+	"storage_type":                   {"storage_type"},
+	"tolerations":                    {"api.tolerations", "content.tolerations", "worker.tolerations"},
+	"topology_spread_constraints":    {"api.topology_spread_constraints", "content.topology_spread_constraints", "worker.topology_spread_constraints"},
+	"web.replicas":                   {"web.replicas"},
+	"web.resource_requirements":      {"web.resource_requirements"},
+	"worker.replicas":                {"worker.replicas"},
+	"worker.resource_requirements":   {"worker.resource_requirements"},
+	"worker.strategy":                {"worker.strategy"},
+}
+
+// ignoredValues are the values of the ansible fields without an equivalent
+// that match the behavior of the golang operator
+var ignoredValues = map[string]struct {
+	value  any
+	reason string
+}{
+	"no_log": {true, "golang operator does not log the secrets"},
+}
+
+// defaultedTargets are the golang fields filled by the converter
+// without a matching ansible field
+var defaultedTargets = []struct {
+	target string
+	reason string
+}{
+	{"pvc", "the existing file storage PVC is reused"},
+	{"database.pvc", "the existing database PVC is reused"},
+	{"cache.pvc", "the existing redis PVC is reused"},
+	{"cache.enabled", "golang operator default"},
+	{"database.readinessProbe", "checks the database with its current user"},
+	{"database.livenessProbe", "checks the database with its current user"},
+	{"image", "galaxy-operator default"},
+	{"image_web", "galaxy-operator default"},
+	{"cache.external_cache_secret", "converted from the redis pulp_settings"},
+	{"route_host", "read from the live route, or built from the cluster ingress domain"},
+	{"ingress_host", "read from the live ingress"},
+	{"ingress_class_name", "read from the live ingress"},
+	{"ingress_tls_secret", "read from the live ingress"},
+}
+
+// NewReport compares the ansible spec with the golang spec built by Convert
+// and describes the fate of every field. The warnings returned by Convert
+// are used as the reason of the dropped fields.
+func NewReport(spec AnsibleSpec, pulpSpec repomanagerv1alpha1.PulpSpec, warnings []string) Report {
+	source := toMap(spec)
+	target := toMap(pulpSpec)
+
+	report := Report{Fields: []FieldReport{}}
+	reported := map[string]bool{}
+	for _, field := range leafFields(source, "") {
+		oldValue := lookupPath(source, field)
+		reason, dropped := warningFor(field, warnings)
+		entry := FieldReport{Field: field, Targets: fieldTargets[field], Reason: reason}
+
+		newValues := []any{}
+		for _, t := range entry.Targets {
+			if value := lookupPath(target, t); !isEmpty(value) {
+				newValues = append(newValues, value)
+			}
+		}
+		ignored, isIgnored := ignoredValues[field]
+		switch {
+		case len(newValues) == 0 && isIgnored && reflect.DeepEqual(oldValue, ignored.value):
+			entry.Fate = Ignored
+			entry.Targets = nil
+			entry.OldValue = oldValue
+			entry.Reason = ignored.reason
+		case len(newValues) == 0 || dropped:
+			entry.Fate = Dropped
+			entry.Targets = nil
+			entry.OldValue = oldValue
+			if entry.Reason == "" {
+				entry.Reason = groupWarningFor(field, warnings)
+			}
+			if entry.Reason == "" {
+				entry.Reason = "no equivalent in golang operator"
+			}
+		case allEqual(oldValue, newValues):
+			entry.Fate = Mapped
+		default:
+			entry.Fate = Transformed
+			entry.OldValue = oldValue
+			entry.NewValue = newValues[0]
+		}
+		for _, t := range entry.Targets {
+			reported[t] = true
+		}
+		report.Fields = append(report.Fields, entry)
+	}
+
+	for _, d := range defaultedTargets {
+		value := lookupPath(target, d.target)
+		if reported[d.target] || isEmpty(value) {
+			continue
+		}
+		report.Fields = append(report.Fields, FieldReport{
+			Fate:     Defaulted,
+			Targets:  []string{d.target},
+			NewValue: value,
+			Reason:   d.reason,
+		})
+	}
+	return report
+}
+
+// Text returns the report as a human-readable table
+func (r Report) Text() string {
+	buf := &bytes.Buffer{}
+	w := tabwriter.NewWriter(buf, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "FIELD\tFATE\tTARGET\tDETAILS")
+	for _, f := range r.Fields {
+		field := f.Field
+		if field == "" {
+			field = "-"
+		}
+		target := strings.Join(f.Targets, ",")
+		if target == "" {
+			target = "-"
+		}
+		details := f.Reason
+		if f.Fate == Transformed {
+			details = shorten(f.OldValue) + " -> " + shorten(f.NewValue)
+		} else if f.Fate == Defaulted {
+			details = shorten(f.NewValue) + " (" + f.Reason + ")"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", field, f.Fate, target, details)
+	}
+	w.Flush()
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+// leafFields returns the path of the fields defined in obj. The fields
+// known by the converter are not expanded, so their whole value is compared.
+func leafFields(obj map[string]any, parent string) []string {
+	keys := []string{}
+	for key := range obj {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	fields := []string{}
+	for _, key := range keys {
+		path := key
+		if parent != "" {
+			path = parent + "." + key
+		}
+		value := obj[key]
+		if isEmpty(value) {
+			continue
+		}
+		if nested, ok := value.(map[string]any); ok && fieldTargets[path] == nil && parent == "" {
+			fields = append(fields, leafFields(nested, path)...)
+			continue
+		}
+		fields = append(fields, path)
+	}
+	return fields
+}
+
+// warningFor returns the warning about a field (without the trailing
+// "it will not be migrated"), if any, and whether the warning says that
+// the field is dropped
+func warningFor(field string, warnings []string) (string, bool) {
+	const notMigrated = ", it will not be migrated"
+	for _, warning := range warnings {
+		name, reason, _ := strings.Cut(warning, ": ")
+		if name == field || strings.HasPrefix(field, name+".") {
+			return strings.TrimSuffix(reason, notMigrated), strings.HasSuffix(reason, notMigrated)
+		}
+	}
+	return "", false
+}
+
+// groupWarningFor returns the warning about a group of fields (like postgres_*)
+// that includes field, if any
+func groupWarningFor(field string, warnings []string) string {
+	for _, warning := range warnings {
+		name, reason, _ := strings.Cut(warning, ": ")
+		if strings.HasSuffix(name, "*") && strings.HasPrefix(field, strings.TrimSuffix(name, "*")) {
+			return reason
+		}
+	}
+	return ""
+}
+
+// toMap converts obj into its json representation
+func toMap(obj any) map[string]any {
+	m := map[string]any{}
+	data, _ := json.Marshal(obj)
+	json.Unmarshal(data, &m)
+	return m
+}
+
+// lookupPath returns the value of a dot separated path in obj
+func lookupPath(obj map[string]any, path string) any {
+	var value any = obj
+	for _, key := range strings.Split(path, ".") {
+		m, ok := value.(map[string]any)
+		if !ok {
+			return nil
+		}
+		value = m[key]
+	}
+	return value
+}
+
+// isEmpty returns true for the values that are not carried by a field
+func isEmpty(value any) bool {
+	switch v := value.(type) {
+	case nil:
+		return true
+	case map[string]any:
+		return len(v) == 0
+	case []any:
+		return len(v) == 0
+	case string:
+		return v == ""
+	}
+	return false
+}
+
+func allEqual(value any, values []any) bool {
+	for _, v := range values {
+		if !reflect.DeepEqual(value, v) {
+			return false
+		}
+	}
+	return true
+}
+
+// shorten returns a compact representation of a value to be used in the text report
+func shorten(value any) string {
+	data, _ := json.Marshal(value)
+	s := string(data)
+	if len(s) > 60 {
+		s = s[:57] + "..."
+	}
+	return s
+}
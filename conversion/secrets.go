@@ -0,0 +1,156 @@
+package conversion
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// ansibleDBSecretKeys maps the keys of the ansible postgres_configuration_secret
+// to the ones expected by the golang operator in database.external_db_secret
+var ansibleDBSecretKeys = map[string]string{
+	"host":     "POSTGRES_HOST",
+	"port":     "POSTGRES_PORT",
+	"username": "POSTGRES_USERNAME",
+	"password": "POSTGRES_PASSWORD",
+	"database": "POSTGRES_DB_NAME",
+	"sslmode":  "POSTGRES_SSLMODE",
+}
+
+// golang operator requires all of these keys in database.external_db_secret
+var externalDBSecretDefaults = map[string]string{
+	"POSTGRES_PORT":    "5432",
+	"POSTGRES_SSLMODE": "prefer",
+}
+
+// IsUnmanagedDB returns true if the ansible postgres_configuration_secret
+// points to a database not deployed by the operator
+func IsUnmanagedDB(data map[string][]byte) bool {
+	return strings.ToLower(string(data["type"])) == "unmanaged"
+}
+
+// ExternalDBSecretData converts the content of the ansible
+// postgres_configuration_secret into the format expected by the golang
+// operator in database.external_db_secret.
+// The returned bool is false when the secret is already in the golang
+// format (and can be used as is).
+func ExternalDBSecretData(data map[string][]byte) (map[string][]byte, bool, error) {
+	if _, found := data["POSTGRES_HOST"]; found {
+		return data, false, nil
+	}
+
+	converted := map[string][]byte{}
+	for oldKey, newKey := range ansibleDBSecretKeys {
+		if value, found := data[oldKey]; found {
+			converted[newKey] = value
+		}
+	}
+	for key, value := range externalDBSecretDefaults {
+		if len(converted[key]) == 0 {
+			converted[key] = []byte(value)
+		}
+	}
+
+	missing := []string{}
+	for oldKey, newKey := range ansibleDBSecretKeys {
+		if len(converted[newKey]) == 0 {
+			missing = append(missing, oldKey)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return nil, true, fmt.Errorf("missing keys in postgres configuration secret: %s", strings.Join(missing, ", "))
+	}
+	return converted, true, nil
+}
+
+// pulpSettings decodes the ansible pulp_settings with lowercase keys
+func pulpSettings(settings runtime.RawExtension) (map[string]any, error) {
+	values := map[string]any{}
+	if len(settings.Raw) == 0 {
+		return values, nil
+	}
+	raw := map[string]any{}
+	if err := json.Unmarshal(settings.Raw, &raw); err != nil {
+		return nil, fmt.Errorf("failed to parse pulp_settings: %w", err)
+	}
+	for key, value := range raw {
+		values[strings.ToLower(key)] = value
+	}
+	return values, nil
+}
+
+// ExternalCacheSecretData builds the content of the golang operator
+// cache.external_cache_secret from the redis_url or redis_host, redis_port,
+// redis_password and redis_db pulp_settings.
+// The returned bool is false when pulp_settings does not point to an
+// external Redis.
+func ExternalCacheSecretData(settings runtime.RawExtension) (map[string][]byte, bool, error) {
+	values, err := pulpSettings(settings)
+	if err != nil {
+		return nil, false, err
+	}
+	setting := func(key string) string {
+		if value, found := values[key]; found && value != nil {
+			return fmt.Sprint(value)
+		}
+		return ""
+	}
+
+	data := map[string][]byte{
+		"REDIS_HOST":     []byte(setting("redis_host")),
+		"REDIS_PORT":     []byte(setting("redis_port")),
+		"REDIS_PASSWORD": []byte(setting("redis_password")),
+		"REDIS_DB":       []byte(setting("redis_db")),
+	}
+	if redisURL := setting("redis_url"); len(redisURL) > 0 {
+		u, err := url.Parse(redisURL)
+		if err != nil || len(u.Hostname()) == 0 {
+			return nil, true, fmt.Errorf("invalid redis_url in pulp_settings")
+		}
+		password, _ := u.User.Password()
+		data = map[string][]byte{
+			"REDIS_HOST":     []byte(u.Hostname()),
+			"REDIS_PORT":     []byte(u.Port()),
+			"REDIS_PASSWORD": []byte(password),
+			"REDIS_DB":       []byte(strings.TrimPrefix(u.Path, "/")),
+		}
+	}
+	if len(data["REDIS_HOST"]) == 0 {
+		return nil, false, nil
+	}
+
+	if len(data["REDIS_PORT"]) == 0 {
+		data["REDIS_PORT"] = []byte("6379")
+	}
+	if len(data["REDIS_DB"]) == 0 {
+		data["REDIS_DB"] = []byte("0")
+	}
+	return data, true, nil
+}
+
+// IsCacheDisabled returns true if the cache_enabled pulp_settings is false
+func IsCacheDisabled(settings runtime.RawExtension) bool {
+	values, err := pulpSettings(settings)
+	if err != nil {
+		return false
+	}
+	enabled, found := values["cache_enabled"]
+	return found && strings.ToLower(fmt.Sprint(enabled)) == "false"
+}
+
+// APIRoot returns the api_root pulp_setting, or the golang operator default
+func APIRoot(settings runtime.RawExtension) string {
+	values, err := pulpSettings(settings)
+	if err != nil {
+		return "/pulp/"
+	}
+	if apiRoot, found := values["api_root"]; found && fmt.Sprint(apiRoot) != "" {
+		return fmt.Sprint(apiRoot)
+	}
+	return "/pulp/"
+}
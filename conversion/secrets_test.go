@@ -0,0 +1,152 @@
+package conversion
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestExternalDBSecretData(t *testing.T) {
+	tests := []struct {
+		name          string
+		data          map[string][]byte
+		expected      map[string][]byte
+		wantConverted bool
+		wantErr       bool
+	}{
+		{
+			name: "ansible keys",
+			data: map[string][]byte{
+				"host":     []byte("db.example.com"),
+				"port":     []byte("5433"),
+				"username": []byte("pulp"),
+				"password": []byte("secret"),
+				"database": []byte("pulp"),
+				"sslmode":  []byte("require"),
+				"type":     []byte("unmanaged"),
+			},
+			expected: map[string][]byte{
+				"POSTGRES_HOST":     []byte("db.example.com"),
+				"POSTGRES_PORT":     []byte("5433"),
+				"POSTGRES_USERNAME": []byte("pulp"),
+				"POSTGRES_PASSWORD": []byte("secret"),
+				"POSTGRES_DB_NAME":  []byte("pulp"),
+				"POSTGRES_SSLMODE":  []byte("require"),
+			},
+			wantConverted: true,
+		},
+		{
+			name: "defaults",
+			data: map[string][]byte{
+				"host":     []byte("db.example.com"),
+				"username": []byte("pulp"),
+				"password": []byte("secret"),
+				"database": []byte("pulp"),
+			},
+			expected: map[string][]byte{
+				"POSTGRES_HOST":     []byte("db.example.com"),
+				"POSTGRES_PORT":     []byte("5432"),
+				"POSTGRES_USERNAME": []byte("pulp"),
+				"POSTGRES_PASSWORD": []byte("secret"),
+				"POSTGRES_DB_NAME":  []byte("pulp"),
+				"POSTGRES_SSLMODE":  []byte("prefer"),
+			},
+			wantConverted: true,
+		},
+		{
+			name: "golang keys",
+			data: map[string][]byte{
+				"POSTGRES_HOST": []byte("db.example.com"),
+			},
+			expected: map[string][]byte{
+				"POSTGRES_HOST": []byte("db.example.com"),
+			},
+		},
+		{
+			name: "missing keys",
+			data: map[string][]byte{
+				"host": []byte("db.example.com"),
+			},
+			wantConverted: true,
+			wantErr:       true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, converted, err := ExternalDBSecretData(tt.data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if converted != tt.wantConverted {
+				t.Errorf("expected converted to be %v", tt.wantConverted)
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestExternalCacheSecretData(t *testing.T) {
+	tests := []struct {
+		name      string
+		settings  string
+		expected  map[string][]byte
+		wantFound bool
+		wantErr   bool
+	}{
+		{
+			name:     "no settings",
+			settings: ``,
+		},
+		{
+			name:     "managed redis",
+			settings: `{"debug": "False"}`,
+		},
+		{
+			name:     "redis host",
+			settings: `{"REDIS_HOST": "redis.example.com", "REDIS_PORT": 6380, "REDIS_PASSWORD": "secret"}`,
+			expected: map[string][]byte{
+				"REDIS_HOST":     []byte("redis.example.com"),
+				"REDIS_PORT":     []byte("6380"),
+				"REDIS_PASSWORD": []byte("secret"),
+				"REDIS_DB":       []byte("0"),
+			},
+			wantFound: true,
+		},
+		{
+			name:     "redis url",
+			settings: `{"redis_url": "redis://:secret@redis.example.com/1"}`,
+			expected: map[string][]byte{
+				"REDIS_HOST":     []byte("redis.example.com"),
+				"REDIS_PORT":     []byte("6379"),
+				"REDIS_PASSWORD": []byte("secret"),
+				"REDIS_DB":       []byte("1"),
+			},
+			wantFound: true,
+		},
+		{
+			name:      "invalid redis url",
+			settings:  `{"redis_url": "redis://"}`,
+			wantFound: true,
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, found, err := ExternalCacheSecretData(runtime.RawExtension{Raw: []byte(tt.settings)})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if found != tt.wantFound {
+				t.Errorf("expected found to be %v", tt.wantFound)
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
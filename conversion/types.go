@@ -0,0 +1,132 @@
+package conversion
+
+import (
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// AnsibleSpec is the spec of the ansible Pulp CR (pulp.pulpproject.org/v1beta1)
+type AnsibleSpec struct {
+	AdminPasswordSecret          string                       `json:"admin_password_secret,omitempty"`
+	Affinity                     *Affinity                    `json:"affinity,omitempty"`
+	Api                          Api                          `json:"api,omitempty"`
+	ContainerTokenSecret         string                       `json:"container_token_secret,omitempty"`
+	Content                      Content                      `json:"content,omitempty"`
+	DBFieldsEncryptionSecret     string                       `json:"db_fields_encryption_secret,omitempty"`
+	DeploymentType               string                       `json:"deployment_type,omitempty"`
+	FileStorageAccessMode        string                       `json:"file_storage_access_mode,omitempty"`
+	FileStorageSize              string                       `json:"file_storage_size,omitempty"`
+	FileStorageClass             string                       `json:"file_storage_storage_class,omitempty"`
+	GunicornAPIWorkers           int                          `json:"gunicorn_api_workers,omitempty"`
+	GunicornContentWorkers       int                          `json:"gunicorn_content_workers,omitempty"`
+	GunicornTimeout              int                          `json:"gunicorn_timeout,omitempty"`
+	HAProxyTimeout               string                       `json:"haproxy_timeout,omitempty"`
+	Image                        string                       `json:"image,omitempty"`
+	ImagePullPolicy              string                       `json:"image_pull_policy,omitempty"`
+	ImagePullSecrets             []string                     `json:"image_pull_secrets,omitempty"`
+	ImageVersion                 string                       `json:"image_version,omitempty"`
+	ImageWeb                     string                       `json:"image_web,omitempty"`
+	ImageWebVersion              string                       `json:"image_web_version,omitempty"`
+	IngressTLSSecret             string                       `json:"ingress_tls_secret,omitempty"`
+	IngressType                  string                       `json:"ingress_type,omitempty"`
+	NginxMaxBodySize             string                       `json:"nginx_client_max_body_size,omitempty"`
+	NginxProxyConnectTimeout     string                       `json:"nginx_proxy_connect_timeout,omitempty"`
+	NginxProxyReadTimeout        string                       `json:"nginx_proxy_read_timeout,omitempty"`
+	NginxProxySendTimeout        string                       `json:"nginx_proxy_send_timeout,omitempty"`
+	ObjectStorageAzureSecret     string                       `json:"object_storage_azure_secret,omitempty"`
+	ObjectStorageS3Secret        string                       `json:"object_storage_s3_secret,omitempty"`
+	PostgresDataPath             string                       `json:"postgres_data_path,omitempty"`
+	PostgresExtraArgs            []string                     `json:"postgres_extra_args,omitempty"`
+	PostgresHostAuthMethod       string                       `json:"postgres_host_auth_method,omitempty"`
+	PostgresImage                string                       `json:"postgres_image,omitempty"`
+	PostgresInitdbArgs           string                       `json:"postgres_initdb_args,omitempty"`
+	PostgresResourceRequirements *corev1.ResourceRequirements `json:"postgres_resource_requirements,omitempty"`
+	PostgresStorageClass         *string                      `json:"postgres_storage_class,omitempty"`
+	PostgresStorageRequirements  *corev1.ResourceRequirements `json:"postgres_storage_requirements,omitempty"`
+	PulpSettings                 runtime.RawExtension         `json:"pulp_settings,omitempty"`
+	Redis                        Redis                        `json:"redis,omitempty"`
+	RedisImage                   string                       `json:"redis_image,omitempty"`
+	RedisResourceRequirements    corev1.ResourceRequirements  `json:"redis_resource_requirements,omitempty"`
+	RedisStorageClass            string                       `json:"redis_storage_class,omitempty"`
+	ResourceManager              ResourceManager              `json:"resource_manager,omitempty"`
+	RouteHost                    string                       `json:"route_host,omitempty"`
+	RouteTLSSecret               string                       `json:"route_tls_secret,omitempty"`
+	SigningScriptsConfigmap      string                       `json:"signing_scripts_configmap,omitempty"`
+	SigningSecret                string                       `json:"signing_secret,omitempty"`
+	SSOSecret                    string                       `json:"sso_secret,omitempty"`
+	StorageType                  string                       `json:"storage_type,omitempty"`
+	Web                          Web                          `json:"web,omitempty"`
+	Worker                       Web                          `json:"worker,omitempty"`
+
+	// these are defined as string in ansible (but I'll let it the same way as we defined in go)
+	Tolerations               []corev1.Toleration               `json:"tolerations,omitempty"`
+	TopologySpreadConstraints []corev1.TopologySpreadConstraint `json:"topology_spread_constraints,omitempty"`
+
+	// ansible version define this as string
+	IngressAnnotations map[string]string `json:"ingress_annotations,omitempty"`
+
+	// this is defined as map[string]string in golang
+	NodeSelector string `json:"node_selector,omitempty"`
+
+	// this is defined as int32 in golang
+	NodePort string `json:"nodeport_port,omitempty"`
+
+	// not found in golang
+	Hostname                           string `json:"hostname,omitempty"`
+	ImagePullSecret                    string `json:"image_pull_secret,omitempty"`
+	LoadbalancerPort                   int    `json:"loadbalancer_port,omitempty"`
+	LoadBalancerProtocol               string `json:"loadbalancer_protocol,omitempty"`
+	NoLog                              *bool  `json:"no_log,omitempty"`
+	PostgresConfigurationSecret        string `json:"postgres_configuration_secret,omitempty"`
+	PostgresKeepPVCAfterUpgrade        bool   `json:"postgres_keep_pvc_after_upgrade,omitempty"`
+	PostgresLabelSelector              string `json:"postgres_label_selector,omitempty"`
+	PostgresMigrantConfigurationSecret string `json:"postgres_migrant_configuration_secret,omitempty"`
+	PostgresSelector                   string `json:"postgres_selector,omitempty"`
+	PostgresToleration                 string `json:"postgres_tolerations,omitempty"`
+	RouteTLSTerminationMechanism       string `json:"route_tls_termination_mechanism,omitempty"`
+	ServiceAnnotations                 string `json:"service_annotations,omitempty"`
+}
+
+type Affinity struct {
+	NodeAffinity *corev1.NodeAffinity `json:"node_affinity,omitempty"`
+}
+
+type Api struct {
+	LogLevel             string                       `json:"log_level,omitempty"`
+	Replicas             int32                        `json:"replicas,omitempty"`
+	ResourceRequirements *corev1.ResourceRequirements `json:"resource_requirements,omitempty"`
+	Strategy             *appsv1.DeploymentStrategy   `json:"strategy,omitempty"`
+}
+
+type Content struct {
+	LogLevel             string                       `json:"log_level,omitempty"`
+	Replicas             int32                        `json:"replicas,omitempty"`
+	ResourceRequirements *corev1.ResourceRequirements `json:"resource_requirements,omitempty"`
+	Strategy             *appsv1.DeploymentStrategy   `json:"strategy,omitempty"`
+}
+
+type Redis struct {
+	LogLevel             string                       `json:"log_level,omitempty"`
+	Replicas             int32                        `json:"replicas,omitempty"`
+	ResourceRequirements *corev1.ResourceRequirements `json:"resource_requirements,omitempty"`
+	Strategy             *appsv1.DeploymentStrategy   `json:"strategy,omitempty"`
+}
+
+type ResourceManager struct {
+	Replicas             int32                        `json:"replicas,omitempty"`
+	ResourceRequirements *corev1.ResourceRequirements `json:"resource_requirements,omitempty"`
+	Strategy             *appsv1.DeploymentStrategy   `json:"strategy,omitempty"`
+}
+
+type Web struct {
+	Replicas             int32                        `json:"replicas,omitempty"`
+	ResourceRequirements *corev1.ResourceRequirements `json:"resource_requirements,omitempty"`
+	Strategy             *appsv1.DeploymentStrategy   `json:"strategy,omitempty"`
+}
+
+type Worker struct {
+	Replicas             int32                        `json:"replicas,omitempty"`
+	ResourceRequirements *corev1.ResourceRequirements `json:"resource_requirements,omitempty"`
+	Strategy             *appsv1.DeploymentStrategy   `json:"strategy,omitempty"`
+}
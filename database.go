@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"migrator/conversion"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// postgresConfigurationSecretName returns the name of the secret with the
+// credentials of the current database
+func (pulp pulp) postgresConfigurationSecretName() string {
+	if pulp.Spec.PostgresConfigurationSecret != "" {
+		return pulp.Spec.PostgresConfigurationSecret
+	}
+	return pulp.oldResourceName + "-postgres-configuration"
+}
+
+// getPostgresConfigurationSecret retrieves the secret defined in the
+// postgres_configuration_secret field of the ansible Pulp CR
+func (pulp pulp) getPostgresConfigurationSecret(c cluster) (*corev1.Secret, error) {
+	secret := &corev1.Secret{}
+	err := c.Get(context.TODO(), client.ObjectKey{Namespace: pulp.oldSubscriptionNamespace, Name: pulp.Spec.PostgresConfigurationSecret}, secret)
+	if apierrors.IsNotFound(err) {
+		fmt.Println("❌ Secret", pulp.Spec.PostgresConfigurationSecret, "not found in", pulp.oldSubscriptionNamespace, "namespace")
+		return nil, fmt.Errorf("secret %s not found: %w", pulp.Spec.PostgresConfigurationSecret, err)
+	} else if err != nil {
+		fmt.Println("❌ Failed to find "+pulp.Spec.PostgresConfigurationSecret+" secret:", err)
+		return nil, fmt.Errorf("failed to get secret %s: %w", pulp.Spec.PostgresConfigurationSecret, err)
+	}
+	return secret, nil
+}
+
+// detectExternalDB checks if the ansible Pulp CR uses a database not deployed
+// by the operator (postgres_configuration_secret with type unmanaged, or
+// without type and no database StatefulSet).
+// In this case there is no database PVC, SVC, or STS to migrate.
+func (pulp *pulp) detectExternalDB(c cluster) error {
+	if len(pulp.Spec.PostgresConfigurationSecret) == 0 {
+		return nil
+	}
+	fmt.Println("🔎 Checking the database configured in", pulp.Spec.PostgresConfigurationSecret, "secret ...")
+	secret, err := pulp.getPostgresConfigurationSecret(c)
+	if err != nil {
+		return err
+	}
+	pulp.externalDB = conversion.IsUnmanagedDB(secret.Data)
+	if _, found := secret.Data["type"]; !found {
+		managed, err := pulp.managedDBStsExists(c)
+		if err != nil {
+			fmt.Println("❌ Failed to list Database StatefulSets:", err)
+			return err
+		}
+		pulp.externalDB = !managed
+	}
+	if pulp.externalDB {
+		fmt.Println("Migrator will keep using the external database, no database pods will be migrated")
+	}
+	return nil
+}
+
+// managedDBStsExists returns true if the ansible operator deployed the
+// database StatefulSet of the Pulp CR (<name>-postgres-<version>)
+func (pulp pulp) managedDBStsExists(c cluster) (bool, error) {
+	stsList := &appsv1.StatefulSetList{}
+	if err := c.List(context.TODO(), stsList, client.InNamespace(pulp.oldSubscriptionNamespace)); err != nil {
+		return false, fmt.Errorf("failed to list the statefulsets: %w", err)
+	}
+	for _, sts := range stsList.Items {
+		if strings.HasPrefix(sts.Name, pulp.oldResourceName+"-postgres-") {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// externalDBSecretName returns the name of the secret created with the
+// external database credentials in the golang operator format
+func (pulp pulp) externalDBSecretName() string {
+	return pulp.newResourceName + "-external-database"
+}
+
+// convertExternalDBSecret makes the external database credentials available
+// to the golang operator. If the postgres_configuration_secret is not already
+// in the format expected by database.external_db_secret a new secret is created.
+func (pulp *pulp) convertExternalDBSecret(c cluster) error {
+	fmt.Println("Converting", pulp.Spec.PostgresConfigurationSecret, "secret to the golang operator format ...")
+	secret, err := pulp.getPostgresConfigurationSecret(c)
+	if err != nil {
+		return err
+	}
+	data, converted, err := conversion.ExternalDBSecretData(secret.Data)
+	if err != nil {
+		fmt.Println("❌ Failed to convert "+pulp.Spec.PostgresConfigurationSecret+" secret:", err)
+		return err
+	}
+
+	// the secret can be used as is
+	if !converted && pulp.newSubscriptionNamespace == pulp.oldSubscriptionNamespace {
+		pulp.externalDBSecret = secret.Name
+		return nil
+	}
+
+	newSecret := &corev1.Secret{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "v1",
+			Kind:       "Secret",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      pulp.externalDBSecretName(),
+			Namespace: pulp.newSubscriptionNamespace,
+			Labels: map[string]string{
+				"app.kubernetes.io/managed-by": "pulp-migrator",
+			},
+		},
+		Data: data,
+	}
+	err = pulp.create(c, newSecret)
+	if err != nil && !apierrors.IsAlreadyExists(err) {
+		fmt.Println("❌ Failed to create "+newSecret.Name+" secret:", err)
+		return fmt.Errorf("failed to create secret %s: %w", newSecret.Name, err)
+	}
+	if err == nil {
+		pulp.original.ExternalDBSecretCreated = true
+	}
+	pulp.externalDBSecret = newSecret.Name
+	fmt.Println("Migrator will use the following secret to connect to the external database:", newSecret.Name)
+	return nil
+}
+
+// deleteExternalDBSecret removes the secret created by convertExternalDBSecret
+func (pulp pulp) deleteExternalDBSecret(c cluster) error {
+	err := pulp.delete(c, &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: pulp.externalDBSecretName(), Namespace: pulp.newSubscriptionNamespace}})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete secret %s: %w", pulp.externalDBSecretName(), err)
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+)
+
+// The requests that change the state of the cluster go through the methods
+// below. In dry-run mode the request is printed and sent with dryRun=All, so
+// the API server validates it without persisting anything.
+
+// create creates obj in the cluster
+func (pulp pulp) create(c cluster, obj client.Object) error {
+	if !pulp.dryRun {
+		return c.Create(context.TODO(), obj)
+	}
+	body, err := json.Marshal(obj)
+	if err != nil {
+		return err
+	}
+	pulp.printPlan("POST", requestPath(c, obj, obj.GetNamespace(), ""), body)
+	return c.Create(context.TODO(), obj, client.DryRunAll)
+}
+
+// patch applies the patch to obj
+func (pulp pulp) patch(c cluster, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+	if !pulp.dryRun {
+		return c.Patch(context.TODO(), obj, patch, opts...)
+	}
+	body, err := patch.Data(obj)
+	if err != nil {
+		return err
+	}
+	pulp.printPlan("PATCH", requestPath(c, obj, obj.GetNamespace(), obj.GetName()), body)
+	return c.Patch(context.TODO(), obj, patch, append(opts, client.DryRunAll)...)
+}
+
+// patchSubResource applies the patch to a subresource (like scale) of obj
+func (pulp pulp) patchSubResource(c cluster, obj client.Object, subResource string, patch client.Patch) error {
+	if !pulp.dryRun {
+		return c.SubResource(subResource).Patch(context.TODO(), obj, patch)
+	}
+	body, err := patch.Data(obj)
+	if err != nil {
+		return err
+	}
+	pulp.printPlan("PATCH", requestPath(c, obj, obj.GetNamespace(), obj.GetName())+"/"+subResource, body)
+	return c.SubResource(subResource).Patch(context.TODO(), obj, patch, client.DryRunAll)
+}
+
+// delete removes obj from the cluster
+func (pulp pulp) delete(c cluster, obj client.Object) error {
+	if !pulp.dryRun {
+		return c.Delete(context.TODO(), obj)
+	}
+	pulp.printPlan("DELETE", requestPath(c, obj, obj.GetNamespace(), obj.GetName()), nil)
+	return c.Delete(context.TODO(), obj, client.DryRunAll)
+}
+
+// printPlan prints a mutating request that would be made by the migrator
+func (pulp pulp) printPlan(method, path string, body []byte) {
+	fmt.Println("📝 [dry-run]", method, path)
+	if body != nil {
+		fmt.Println("   ", string(body))
+	}
+}
+
+// requestPath returns the API path of the object with the given name in the
+// namespace, or of the collection of its kind if name is empty, from the REST
+// mapping of its kind
+func requestPath(c cluster, obj client.Object, namespace, name string) string {
+	gvk, err := apiutil.GVKForObject(obj, c.Scheme())
+	if err != nil {
+		return fmt.Sprintf("%T", obj)
+	}
+	// in dry-run mode the CRDs of the golang operator could be missing
+	plural, _ := meta.UnsafeGuessKindToResource(gvk)
+	resource := plural.Resource
+	namespaced := namespace != ""
+	if mapping, err := c.RESTMapper().RESTMapping(gvk.GroupKind(), gvk.Version); err == nil {
+		resource = mapping.Resource.Resource
+		namespaced = mapping.Scope.Name() == meta.RESTScopeNameNamespace
+	}
+
+	path := "/apis/" + gvk.GroupVersion().String()
+	if gvk.Group == "" {
+		path = "/api/" + gvk.Version
+	}
+	if namespaced {
+		path += "/namespaces/" + namespace
+	}
+	path += "/" + resource
+	if name != "" {
+		path += "/" + name
+	}
+	return path
+}
+
+// describe returns the kind and the namespace/name (or only the name of a
+// cluster-scoped object) of obj
+func describe(c cluster, obj client.Object) string {
+	if obj.GetNamespace() == "" {
+		return kindOf(c, obj) + " " + obj.GetName()
+	}
+	return kindOf(c, obj) + " " + client.ObjectKeyFromObject(obj).String()
+}
+
+// kindOf returns the kind of obj, from the object itself or from the scheme
+func kindOf(c cluster, obj client.Object) string {
+	gvk, err := apiutil.GVKForObject(obj, c.Scheme())
+	if err != nil {
+		return fmt.Sprintf("%T", obj)
+	}
+	return gvk.Kind
+}
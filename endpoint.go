@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"migrator/conversion"
+
+	routev1 "github.com/openshift/api/route/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// ownedBy returns true if the object has an owner reference to uid
+func ownedBy(obj metav1.Object, uid string) bool {
+	for _, owner := range obj.GetOwnerReferences() {
+		if string(owner.UID) == uid {
+			return true
+		}
+	}
+	return false
+}
+
+// getEndpoint returns the settings of the Route or Ingress (depending on
+// ingress_type) created by the ansible operator for the Pulp CR, or nil if
+// none is found. They are found through their owner reference to the CR,
+// the one named after it is preferred.
+func (pulp pulp) getEndpoint(c cluster) (*conversion.Endpoint, error) {
+	uid := string(pulp.Metadata.UID)
+	if uid == "" {
+		return nil, nil
+	}
+
+	switch strings.ToLower(pulp.Spec.IngressType) {
+	case "route":
+		routeList := &routev1.RouteList{}
+		err := c.List(context.TODO(), routeList, client.InNamespace(pulp.oldSubscriptionNamespace))
+		// routes are only served by OpenShift
+		if isMissing(err) {
+			return nil, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to list the routes: %w", err)
+		}
+		var found *routev1.Route
+		for i, route := range routeList.Items {
+			if ownedBy(&route, uid) && (found == nil || route.Name == pulp.oldResourceName) {
+				found = &routeList.Items[i]
+			}
+		}
+		if found == nil {
+			return nil, nil
+		}
+		endpoint := &conversion.Endpoint{Kind: "Route", Name: found.Name, Host: found.Spec.Host}
+		if found.Spec.TLS != nil {
+			endpoint.TLSTermination = string(found.Spec.TLS.Termination)
+			endpoint.TLSCertificate = found.Spec.TLS.Certificate != ""
+		}
+		return endpoint, nil
+
+	case "ingress":
+		ingressList := &networkingv1.IngressList{}
+		if err := c.List(context.TODO(), ingressList, client.InNamespace(pulp.oldSubscriptionNamespace)); err != nil {
+			return nil, fmt.Errorf("failed to list the ingresses: %w", err)
+		}
+		var found *networkingv1.Ingress
+		for i, ingress := range ingressList.Items {
+			if ownedBy(&ingress, uid) && (found == nil || ingress.Name == pulp.oldResourceName+"-ingress") {
+				found = &ingressList.Items[i]
+			}
+		}
+		if found == nil {
+			return nil, nil
+		}
+		endpoint := &conversion.Endpoint{Kind: "Ingress", Name: found.Name}
+		for _, rule := range found.Spec.Rules {
+			if rule.Host != "" {
+				endpoint.Host = rule.Host
+				break
+			}
+		}
+		for _, tls := range found.Spec.TLS {
+			if tls.SecretName != "" {
+				endpoint.TLSSecret = tls.SecretName
+				break
+			}
+		}
+		// the annotation is used by the ingresses created before ingressClassName
+		endpoint.IngressClassName = found.Annotations["kubernetes.io/ingress.class"]
+		if found.Spec.IngressClassName != nil {
+			endpoint.IngressClassName = *found.Spec.IngressClassName
+		}
+		return endpoint, nil
+	}
+	return nil, nil
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"migrator/conversion"
+)
+
+// galaxy converts an ansible Galaxy CR (galaxy.ansible.com, deployed by the
+// galaxy-operator) into a golang Pulp CR with deployment_type galaxy.
+// Besides the conversion, the migration steps are the same of a Pulp CR.
+type galaxy struct {
+	pulp
+}
+
+var _ crd = galaxy{}
+
+func (galaxy galaxy) convert(c cluster) error {
+	fmt.Println("Converting Galaxy CR to the new CRD ...")
+	return galaxy.createGolangCR(c, conversion.ConvertGalaxy)
+}
+
+// convertSpec returns the function that maps the spec of the ansible CR being migrated
+func (pulp pulp) convertSpec() convertFunc {
+	if pulp.isGalaxy() {
+		return conversion.ConvertGalaxy
+	}
+	return conversion.Convert
+}
+
+// isGalaxy returns true if the ansible CR being migrated is a Galaxy CR
+func (pulp pulp) isGalaxy() bool {
+	return strings.HasPrefix(pulp.oldApi, "galaxy.ansible.com/")
+}
+
+// getDBUser returns the user of the current database, from the ansible
+// postgres configuration secret, or an empty string if it is not found
+func (pulp pulp) getDBUser(c cluster) string {
+	pulp.Spec.PostgresConfigurationSecret = pulp.postgresConfigurationSecretName()
+	secret, err := pulp.getPostgresConfigurationSecret(c)
+	if err != nil {
+		fmt.Println("⚠️  The database user is unknown, golang operator will check the database pods with its default user")
+		return ""
+	}
+	return string(secret.Data["username"])
+}
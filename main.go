@@ -3,33 +3,44 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"strings"
 	"time"
 
+	"migrator/conversion"
+
 	configv1 "github.com/openshift/api/config/v1"
 	operatorsv1alpha1 "github.com/operator-framework/api/pkg/operators/v1alpha1"
 	repomanagerv1alpha1 "github.com/pulp/pulp-operator/api/v1alpha1"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
-	"k8s.io/client-go/kubernetes"
-	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
+// crd is implemented by the converters of each kind of ansible CR into a
+// golang Pulp CR
 type crd interface {
-	convert(*kubernetes.Clientset) any
+	convert(cluster) error
 }
 
+// convertFunc maps the spec of an ansible CR into the golang Pulp CR spec
+type convertFunc func(conversion.AnsibleSpec, conversion.ClusterInfo) (repomanagerv1alpha1.PulpSpec, []string)
+
+var _ crd = pulp{}
+
 type pulp struct {
-	ApiVersion string            `json:"apiVersion"`
-	Kind       string            `json:"kind"`
-	Metadata   metav1.ObjectMeta `json:"metadata"`
-	Spec       AnsibleSpec       `json:"spec"`
-	Status     any               `json:"status"`
+	ApiVersion string                 `json:"apiVersion"`
+	Kind       string                 `json:"kind"`
+	Metadata   metav1.ObjectMeta      `json:"metadata"`
+	Spec       conversion.AnsibleSpec `json:"spec"`
+	Status     any                    `json:"status"`
 
 	// ansible subscription data
 	oldSubscriptionName      string
@@ -44,6 +55,55 @@ type pulp struct {
 	newSubscriptionSourceNamespace     string
 	newSubscriptionStartingCSV         string
 
+	// index image of the CatalogSource created (or reused) by the migrator,
+	// the CatalogSource should already exist if it is empty
+	indexImage string
+
+	// print the plan of every mutating request instead of changing the cluster
+	dryRun bool
+
+	// format of the conversion report (text or json)
+	reportFormat string
+
+	// how the installation is backed up before the migration (none, cr or
+	// pg-dump) and how long to wait for the backup
+	backupMethod  string
+	backupTimeout time.Duration
+
+	// convert the unfinished ansible restores, the golang operator runs them
+	// right away against the migrated installation
+	convertRestores bool
+
+	// approve the InstallPlan of the starting CSV when the approval is Manual,
+	// and how long to wait for the golang operator to be installed
+	approveInstallPlan bool
+	operatorTimeout    time.Duration
+
+	// create the OperatorGroup of the golang operator namespace, or change
+	// its target namespaces, if it does not support the install modes of the
+	// starting CSV
+	adjustOperatorGroup bool
+
+	// how long to wait for the golang operator to bring the migrated
+	// installation up, verification is skipped if it is 0
+	verifyTimeout time.Duration
+
+	// restore the resources modified by the migration if a step fails
+	rollbackOnFailure bool
+
+	// the subscription is shared with a Pulp CR migrated before this one
+	// (batch mode), so it was already replaced by the golang operator one
+	sharedSubscription bool
+
+	// the ansible operator was deployed without OLM (make deploy), so its
+	// resources are removed instead of the Subscription and CSV
+	withoutOLM bool
+
+	// OLM is not installed, so the golang operator is installed from the
+	// operatorManifests file or directory (or the embedded manifests)
+	installManifests  bool
+	operatorManifests string
+
 	// CRD data
 	oldApi          string
 	oldResource     string
@@ -55,315 +115,215 @@ type pulp struct {
 	oldDBPVC        string
 	oldDBSVC        string
 	oldDBSts        string
-}
 
-type AnsibleSpec struct {
-	AdminPasswordSecret          string                       `json:"admin_password_secret,omitempty"`
-	Affinity                     *corev1.NodeAffinity         `json:"affinity,omitempty"`
-	Api                          Api                          `json:"api,omitempty"`
-	ContainerTokenSecret         string                       `json:"container_token_secret,omitempty"`
-	Content                      Content                      `json:"content,omitempty"`
-	DBFieldsEncryptionSecret     string                       `json:"db_fields_encryption_secret,omitempty"`
-	DeploymentType               string                       `json:"deployment_type,omitempty"`
-	FileStorageAccessMode        string                       `json:"file_storage_access_mode,omitempty"`
-	FileStorageSize              string                       `json:"file_storage_size,omitempty"`
-	FileStorageClass             string                       `json:"file_storage_storage_class,omitempty"`
-	GunicornAPIWorkers           int                          `json:"gunicorn_api_workers,omitempty"`
-	GunicornContentWorkers       int                          `json:"gunicorn_content_workers,omitempty"`
-	GunicornTimeout              int                          `json:"gunicorn_timeout,omitempty"`
-	HAProxyTimeout               string                       `json:"haproxy_timeout,omitempty"`
-	Image                        string                       `json:"image,omitempty"`
-	ImagePullPolicy              string                       `json:"image_pull_policy,omitempty"`
-	ImagePullSecrets             []string                     `json:"image_pull_secrets,omitempty"`
-	ImageVersion                 string                       `json:"image_version,omitempty"`
-	ImageWeb                     string                       `json:"image_web,omitempty"`
-	ImageWebVersion              string                       `json:"image_web_version,omitempty"`
-	IngressTLSSecret             string                       `json:"ingress_tls_secret,omitempty"`
-	IngressType                  string                       `json:"ingress_type,omitempty"`
-	NginxMaxBodySize             string                       `json:"nginx_client_max_body_size,omitempty"`
-	NginxProxyConnectTimeout     string                       `json:"nginx_proxy_connect_timeout,omitempty"`
-	NginxProxyReadTimeout        string                       `json:"nginx_proxy_read_timeout,omitempty"`
-	NginxProxySendTimeout        string                       `json:"nginx_proxy_send_timeout,omitempty"`
-	ObjectStorageAzureSecret     string                       `json:"object_storage_azure_secret,omitempty"`
-	ObjectStorageS3Secret        string                       `json:"object_storage_s3_secret,omitempty"`
-	PostgresDataPath             string                       `json:"postgres_data_path,omitempty"`
-	PostgresExtraArgs            []string                     `json:"postgres_extra_args,omitempty"`
-	PostgresHostAuthMethod       string                       `json:"postgres_host_auth_method,omitempty"`
-	PostgresImage                string                       `json:"postgres_image,omitempty"`
-	PostgresInitdbArgs           string                       `json:"postgres_initdb_args,omitempty"`
-	PostgresResourceRequirements *corev1.ResourceRequirements `json:"postgres_resource_requirements,omitempty"`
-	PostgresStorageClass         *string                      `json:"postgres_storage_class,omitempty"`
-	PostgresStorageRequirements  string                       `json:"postgres_storage_requirements,omitempty"`
-	PulpSettings                 runtime.RawExtension         `json:"pulp_settings,omitempty"`
-	Redis                        Redis                        `json:"redis,omitempty"`
-	RedisImage                   string                       `json:"redis_image,omitempty"`
-	RedisResourceRequirements    corev1.ResourceRequirements  `json:"redis_resource_requirements,omitempty"`
-	RedisStorageClass            string                       `json:"redis_storage_class,omitempty"`
-	ResourceManager              ResourceManager              `json:"resource_manager,omitempty"`
-	RouteHost                    string                       `json:"route_host,omitempty"`
-	RouteTLSSecret               string                       `json:"route_tls_secret,omitempty"`
-	SigningScriptsConfigmap      string                       `json:"signing_scripts_configmap,omitempty"`
-	SigningSecret                string                       `json:"signing_secret,omitempty"`
-	SSOSecret                    string                       `json:"sso_secret,omitempty"`
-	StorageType                  string                       `json:"storage_type,omitempty"`
-	Web                          Web                          `json:"web,omitempty"`
-	Worker                       Web                          `json:"worker,omitempty"`
-
-	// these are defined as string in ansible (but I'll let it the same way as we defined in go)
-	Tolerations               []corev1.Toleration               `json:"tolerations,omitempty"`
-	TopologySpreadConstraints []corev1.TopologySpreadConstraint `json:"topology_spread_constraints,omitempty"`
-
-	// ansible version define this as string
-	IngressAnnotations map[string]string `json:"ingress_annotations,omitempty"`
-
-	// this is defined as map[string]string in golang
-	NodeSelector string `json:"node_selector,omitempty"`
-
-	// this is defined as int32 in golang
-	NodePort string `json:"nodeport_port,omitempty"`
-
-	// not found in golang
-	Hostname                           string `json:"hostname,omitempty"`
-	ImagePullSecret                    string `json:"image_pull_secret,omitempty"`
-	LoadbalancerPort                   int    `json:"loadbalancer_port,omitempty"`
-	LoadBalancerProtocol               string `json:"loadbalancer_protocol,omitempty"`
-	NoLog                              string `json:"no_log,omitempty"`
-	PostgresConfigurationSecret        string `json:"postgres_configuration_secret,omitempty"`
-	PostgresKeepPVCAfterUpgrade        bool   `json:"postgres_keep_pvc_after_upgrade,omitempty"`
-	PostgresLabelSelector              string `json:"postgres_label_selector,omitempty"`
-	PostgresMigrantConfigurationSecret string `json:"postgres_migrant_configuration_secret,omitempty"`
-	PostgresSelector                   string `json:"postgres_selector,omitempty"`
-	PostgresToleration                 string `json:"postgres_tolerations,omitempty"`
-	RouteTLSTerminationMechanism       string `json:"route_tls_termination_mechanism,omitempty"`
-	ServiceAnnotations                 string `json:"service_annotations,omitempty"`
-}
+	// the database is not deployed by the ansible operator and
+	// externalDBSecret holds its credentials in the golang operator format
+	externalDB       bool
+	externalDBSecret string
 
-type Api struct {
-	LogLevel             string                       `json:"log_level,omitempty"`
-	Replicas             int32                        `json:"replicas,omitempty"`
-	ResourceRequirements *corev1.ResourceRequirements `json:"resource_requirements,omitempty"`
-	Strategy             *appsv1.DeploymentStrategy   `json:"strategy,omitempty"`
-}
+	// user of the current database
+	dbUser string
 
-type Content struct {
-	LogLevel             string                       `json:"log_level,omitempty"`
-	Replicas             int32                        `json:"replicas,omitempty"`
-	ResourceRequirements *corev1.ResourceRequirements `json:"resource_requirements,omitempty"`
-	Strategy             *appsv1.DeploymentStrategy   `json:"strategy,omitempty"`
-}
+	// Route or Ingress created by the ansible operator, its settings are
+	// kept over the ones in the spec
+	endpoint *conversion.Endpoint
 
-type Redis struct {
-	LogLevel             string                       `json:"log_level,omitempty"`
-	Replicas             int32                        `json:"replicas,omitempty"`
-	ResourceRequirements *corev1.ResourceRequirements `json:"resource_requirements,omitempty"`
-	Strategy             *appsv1.DeploymentStrategy   `json:"strategy,omitempty"`
-}
+	// same for redis
+	oldRedisPVC         string
+	externalCache       bool
+	externalCacheSecret string
 
-type ResourceManager struct {
-	Replicas             int32                        `json:"replicas,omitempty"`
-	ResourceRequirements *corev1.ResourceRequirements `json:"resource_requirements,omitempty"`
-	Strategy             *appsv1.DeploymentStrategy   `json:"strategy,omitempty"`
-}
+	// state of the resources before the migration, used by rollback
+	original *originalState
+
+	// progress of the migration, used to resume it
+	checkpoint *checkpoint
 
-type Web struct {
-	Replicas             int32                        `json:"replicas,omitempty"`
-	ResourceRequirements *corev1.ResourceRequirements `json:"resource_requirements,omitempty"`
-	Strategy             *appsv1.DeploymentStrategy   `json:"strategy,omitempty"`
+	// the progress is not recorded (conversion-only mode), so a later
+	// migration does not skip the steps done by this run
+	skipCheckpoint bool
 }
 
-type Worker struct {
-	Replicas             int32                        `json:"replicas,omitempty"`
-	ResourceRequirements *corev1.ResourceRequirements `json:"resource_requirements,omitempty"`
-	Strategy             *appsv1.DeploymentStrategy   `json:"strategy,omitempty"`
+// dbLabels selects the database resources deployed by the ansible operator
+// for the Pulp CR being migrated
+func (pulp pulp) dbLabels() client.MatchingLabels {
+	return client.MatchingLabels{
+		"app.kubernetes.io/instance":   "postgres-" + pulp.oldResourceName,
+		"app.kubernetes.io/component":  "database",
+		"app.kubernetes.io/managed-by": pulp.oldSubscriptionName,
+	}
 }
 
-func (pulp *pulp) getCurrentDBPVC(clientset *kubernetes.Clientset) error {
+func (pulp *pulp) getCurrentDBPVC(c cluster) error {
 	fmt.Println("🔎 Retrieving the current Database PVC ...")
-	data, err := clientset.RESTClient().
-		Get().
-		AbsPath("/api/v1").
-		Namespace(pulp.oldSubscriptionNamespace).
-		Resource("persistentvolumeclaims").
-		Param("labelSelector", "app.kubernetes.io/component=database,app.kubernetes.io/managed-by="+pulp.oldSubscriptionName).
-		DoRaw(context.TODO())
-	if err != nil {
-		fmt.Println("❌ Failed to find Database PVC:", err)
-		return err
-	}
 	pvcList := &corev1.PersistentVolumeClaimList{}
-	json.Unmarshal(data, pvcList)
+	if err := c.List(context.TODO(), pvcList, client.InNamespace(pulp.oldSubscriptionNamespace), pulp.dbLabels()); err != nil {
+		fmt.Println("❌ Failed to list Database PVCs:", err)
+		return fmt.Errorf("failed to list the database PVCs: %w", err)
+	}
 	if len(pvcList.Items) >= 1 {
-		pulp.oldDBPVC = pvcList.Items[0].ObjectMeta.Name
-		fmt.Println("Migrator will use the following PVC to the database pods:", pvcList.Items[0].ObjectMeta.Name)
+		pvc := pvcList.Items[0]
+		pulp.oldDBPVC = pvc.ObjectMeta.Name
+		fmt.Println("Migrator will use the following PVC to the database pods:", pvc.ObjectMeta.Name)
 	}
 
 	return nil
 }
 
-func (pulp *pulp) getCurrentDBService(clientset *kubernetes.Clientset) error {
+func (pulp *pulp) getCurrentDBService(c cluster) error {
 	fmt.Println("🔎 Retrieving the current Database Service ...")
-	data, err := clientset.RESTClient().
-		Get().
-		AbsPath("/api/v1").
-		Namespace(pulp.oldSubscriptionNamespace).
-		Resource("services").
-		Param("labelSelector", "app.kubernetes.io/component=database,app.kubernetes.io/managed-by="+pulp.oldSubscriptionName).
-		DoRaw(context.TODO())
-	if err != nil {
-		fmt.Println("❌ Failed to find Database Service:", err)
-		return err
-	}
 	svcList := &corev1.ServiceList{}
-	json.Unmarshal(data, svcList)
+	if err := c.List(context.TODO(), svcList, client.InNamespace(pulp.oldSubscriptionNamespace), pulp.dbLabels()); err != nil {
+		fmt.Println("❌ Failed to list Database Services:", err)
+		return fmt.Errorf("failed to list the database Services: %w", err)
+	}
 	if len(svcList.Items) >= 1 {
-		pulp.oldDBSVC = svcList.Items[0].ObjectMeta.Name
-		fmt.Println("Migrator will use the following SVC to the database pods:", svcList.Items[0].ObjectMeta.Name)
+		svc := svcList.Items[0]
+		pulp.oldDBSVC = svc.ObjectMeta.Name
+		pulp.original.ServiceSelector = svc.Spec.Selector
+		fmt.Println("Migrator will use the following SVC to the database pods:", svc.ObjectMeta.Name)
 	} else {
 		fmt.Println("❌ Failed to find Database Service")
-		return fmt.Errorf("database Service not found")
+		return fmt.Errorf("database Service not found in %s namespace", pulp.oldSubscriptionNamespace)
 	}
 
 	return nil
 }
 
-func (pulp *pulp) getCurrentDBSts(clientset *kubernetes.Clientset) error {
+func (pulp *pulp) getCurrentDBSts(c cluster) error {
 	fmt.Println("🔎 Retrieving the current Database StatefulSet ...")
-	data, err := clientset.RESTClient().
-		Get().
-		AbsPath("/apis/apps/v1").
-		Namespace(pulp.oldSubscriptionNamespace).
-		Resource("statefulsets").
-		Param("labelSelector", "app.kubernetes.io/component=database,app.kubernetes.io/managed-by="+pulp.oldSubscriptionName).
-		DoRaw(context.TODO())
-	if err != nil {
-		fmt.Println("❌ Failed to find Database Service:", err)
-		return err
-	}
 	stsList := &appsv1.StatefulSetList{}
-	json.Unmarshal(data, stsList)
+	if err := c.List(context.TODO(), stsList, client.InNamespace(pulp.oldSubscriptionNamespace), pulp.dbLabels()); err != nil {
+		fmt.Println("❌ Failed to list Database StatefulSets:", err)
+		return fmt.Errorf("failed to list the database StatefulSets: %w", err)
+	}
 	if len(stsList.Items) >= 1 {
-		pulp.oldDBSts = stsList.Items[0].ObjectMeta.Name
-		fmt.Println("Migrator will downscale the following StatefulSet to 0 replica pods:", stsList.Items[0].ObjectMeta.Name)
+		sts := stsList.Items[0]
+		pulp.oldDBSts = sts.ObjectMeta.Name
+		pulp.original.StsReplicas = 1
+		if sts.Spec.Replicas != nil {
+			pulp.original.StsReplicas = *sts.Spec.Replicas
+		}
+		fmt.Println("Migrator will downscale the following StatefulSet to 0 replica pods:", sts.ObjectMeta.Name)
 	} else {
 		fmt.Println("❌ Failed to find Database StatefulSet")
-		return fmt.Errorf("database StatefulSet not found")
+		return fmt.Errorf("database StatefulSet not found in %s namespace", pulp.oldSubscriptionNamespace)
 	}
 
 	return nil
 }
 
-func (pulp pulp) getCurrentCSV(clientset *kubernetes.Clientset) (string, error) {
+func (pulp pulp) getCurrentCSV(c cluster) (string, error) {
 	fmt.Println("🔎 Retrieving the current csv from subscription", pulp.oldSubscriptionName, "...")
-	data, err := clientset.RESTClient().
-		Get().
-		AbsPath("/apis/operators.coreos.com/v1alpha1").
-		Namespace(pulp.oldSubscriptionNamespace).
-		Resource("subscriptions").
-		Name(pulp.oldSubscriptionName).
-		DoRaw(context.TODO())
-	if err != nil {
-		fmt.Println("❌ Failed to find Subscription:", err)
-		return "", err
-	}
 	sub := &operatorsv1alpha1.Subscription{}
-	json.Unmarshal(data, sub)
+	err := c.Get(context.TODO(), client.ObjectKey{Namespace: pulp.oldSubscriptionNamespace, Name: pulp.oldSubscriptionName}, sub)
+	if apierrors.IsNotFound(err) {
+		fmt.Println("❌ Subscription", pulp.oldSubscriptionName, "not found in", pulp.oldSubscriptionNamespace, "namespace")
+		return "", fmt.Errorf("subscription %s not found: %w", pulp.oldSubscriptionName, err)
+	} else if err != nil {
+		fmt.Println("❌ Failed to retrieve Subscription:", err)
+		return "", fmt.Errorf("failed to get subscription %s: %w", pulp.oldSubscriptionName, err)
+	}
 	currentCSV := sub.Status.CurrentCSV
 	fmt.Println("Current CSV Name:", currentCSV)
+	pulp.original.Subscription = sub
+	pulp.original.CSVName = currentCSV
 	return currentCSV, nil
 }
 
-func (pulp pulp) deleteSubscription(clientset *kubernetes.Clientset) error {
+func (pulp pulp) deleteSubscription(c cluster) error {
 	fmt.Println("🗑️  Deleting", pulp.oldSubscriptionName, "subscription ...")
-	data, err := clientset.RESTClient().
-		Delete().
-		AbsPath("/apis/operators.coreos.com/v1alpha1").
-		Namespace(pulp.oldSubscriptionNamespace).
-		Resource("subscriptions").
-		Name(pulp.oldSubscriptionName).
-		DoRaw(context.TODO())
-	if err != nil {
-		fmt.Println("❌ Failed to find Subscription:", err)
-		return err
-	}
-
-	fmt.Println(string(data))
+	err := pulp.delete(c, &operatorsv1alpha1.Subscription{
+		ObjectMeta: metav1.ObjectMeta{Name: pulp.oldSubscriptionName, Namespace: pulp.oldSubscriptionNamespace},
+	})
+	if apierrors.IsNotFound(err) {
+		fmt.Println("⏭️  Subscription", pulp.oldSubscriptionName, "was already deleted")
+	} else if err != nil {
+		fmt.Println("❌ Failed to delete Subscription:", err)
+		return fmt.Errorf("failed to delete subscription %s: %w", pulp.oldSubscriptionName, err)
+	}
+	pulp.original.SubscriptionDeleted = true
 	return nil
 }
 
-func (pulp pulp) deleteCSV(clientset *kubernetes.Clientset, csvName string) error {
+func (pulp pulp) deleteCSV(c cluster, csvName string) error {
 	fmt.Println("🗑️  Deleting", csvName, "CSV ...")
-	data, err := clientset.RESTClient().
-		Delete().
-		AbsPath("/apis/operators.coreos.com/v1alpha1").
-		Namespace(pulp.oldSubscriptionNamespace).
-		Resource("clusterserviceversions").
-		Name(csvName).
-		DoRaw(context.TODO())
-	if err != nil {
-		fmt.Println("❌ Failed to find Subscription:", err)
-		return err
+	err := pulp.delete(c, &operatorsv1alpha1.ClusterServiceVersion{
+		ObjectMeta: metav1.ObjectMeta{Name: csvName, Namespace: pulp.oldSubscriptionNamespace},
+	})
+	if apierrors.IsNotFound(err) {
+		fmt.Println("⏭️  CSV", csvName, "was already deleted")
+	} else if err != nil {
+		fmt.Println("❌ Failed to delete CSV:", err)
+		return fmt.Errorf("failed to delete CSV %s: %w", csvName, err)
 	}
-
-	fmt.Println(string(data))
 	return nil
 }
 
-func (pulp pulp) deleteDeployments(clientset *kubernetes.Clientset) error {
-	components := []string{"api", "content-server", "worker", "webserver", "cache"}
-
-	for _, component := range components {
-		_, err := clientset.RESTClient().
-			Delete().
-			AbsPath("/apis/apps/v1").
-			Namespace(pulp.oldSubscriptionNamespace).
-			Resource("deployments").
-			Param("labelSelector", "app.kubernetes.io/component="+component).
-			DoRaw(context.TODO())
-		if err != nil {
-			fmt.Println("❌ Failed to find", component, "deployment:", err)
-			return err
-		} else {
-			fmt.Println("🗑️  Deleting", component, "deployment ...")
+// ansibleDeployments returns the names of the deployments of the Pulp CR
+// being migrated, by component. They are named after the CR, so the ones of
+// the other Pulp CRs in the namespace are left untouched.
+func (pulp pulp) ansibleDeployments() [][2]string {
+	return [][2]string{
+		{"api", pulp.oldResourceName + "-api"},
+		{"content-server", pulp.oldResourceName + "-content"},
+		{"worker", pulp.oldResourceName + "-worker"},
+		{"webserver", pulp.oldResourceName + "-web"},
+		{"cache", pulp.oldResourceName + "-redis"},
+	}
+}
+
+func (pulp pulp) deleteDeployments(c cluster) error {
+	deployments := pulp.ansibleDeployments()
+
+	for _, d := range deployments {
+		if err := pulp.recordDeployment(c, d[1]); err != nil {
+			fmt.Println("❌ Failed to find", d[0], "deployment:", err)
+			return fmt.Errorf("failed to get deployment %s: %w", d[1], err)
+		}
+	}
+
+	pulp.original.DeploymentsDeleted = true
+	for _, d := range deployments {
+		fmt.Println("🗑️  Deleting", d[0], "deployment ...")
+		err := pulp.delete(c, &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: d[1], Namespace: pulp.oldSubscriptionNamespace}})
+		if err != nil && !apierrors.IsNotFound(err) {
+			fmt.Println("❌ Failed to delete", d[0], "deployment:", err)
+			return fmt.Errorf("failed to delete deployment %s: %w", d[1], err)
 		}
 	}
 	return nil
 }
 
-func (pulp pulp) downscaleDBReplicas(clientset *kubernetes.Clientset) error {
+// scaleDBSts sets the number of replicas of the ansible database StatefulSet
+func (pulp pulp) scaleDBSts(c cluster, replicas int32) error {
+	sts := &appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{Name: pulp.oldDBSts, Namespace: pulp.oldSubscriptionNamespace}}
+	patch := client.RawPatch(types.MergePatchType, []byte(fmt.Sprintf(`{"spec":{"replicas":%d}}`, replicas)))
+	return pulp.patchSubResource(c, sts, "scale", patch)
+}
+
+func (pulp pulp) downscaleDBReplicas(c cluster) error {
 	fmt.Println("Scaling old Database STS to 0 replicas ...")
-	if _, err := clientset.RESTClient().
-		Patch(types.MergePatchType).
-		AbsPath("/apis/apps/v1").
-		Namespace(pulp.oldSubscriptionNamespace).
-		Resource("statefulsets").
-		Name(pulp.oldDBSts).
-		Suffix("scale").
-		Body([]byte(`{"spec":{"replicas":0}}`)).
-		DoRaw(context.TODO()); err != nil {
+	if err := pulp.scaleDBSts(c, 0); err != nil {
 		fmt.Println("❌ Failed to set "+pulp.oldDBSts+" STS to 0 replicas:", err)
-		return err
+		return fmt.Errorf("failed to scale statefulset %s: %w", pulp.oldDBSts, err)
 	}
+	pulp.original.StsDownscaled = true
 	return nil
 }
 
-func (pulp *pulp) updateDBService(clientset *kubernetes.Clientset) error {
+func (pulp *pulp) updateDBService(c cluster) error {
 	fmt.Println("Updating " + pulp.oldDBSVC + " Database Service ...")
+	pulp.original.ServiceUpdated = true
+	svc := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: pulp.oldDBSVC, Namespace: pulp.oldSubscriptionNamespace}}
 
 	// remove old label selectors
 	labels := []string{"app.kubernetes.io/instance", "app.kubernetes.io/component", "app.kubernetes.io/managed-by", "app.kubernetes.io/name", "app.kubernetes.io/part-of", "app.kubernetes.io/version"}
 	for _, label := range labels {
-		_, err := clientset.RESTClient().
-			Patch(types.MergePatchType).
-			AbsPath("/api/v1").
-			Namespace(pulp.oldSubscriptionNamespace).
-			Resource("services").
-			Name(pulp.oldDBSVC).
-			Param("fieldManager", "kubectl-label").
-			Body([]byte(`{"spec":{"selector":{"` + label + `":null}}}`)).
-			DoRaw(context.TODO())
-		if err != nil {
+		patch := client.RawPatch(types.MergePatchType, []byte(`{"spec":{"selector":{"`+label+`":null}}}`))
+		if err := pulp.patch(c, svc, patch, client.FieldOwner("kubectl-label")); err != nil {
 			fmt.Println("❌ Failed to remove old labels from Database Service:", err)
-			return err
+			return fmt.Errorf("failed to update service %s: %w", pulp.oldDBSVC, err)
 		}
 	}
 
@@ -373,24 +333,16 @@ func (pulp *pulp) updateDBService(clientset *kubernetes.Clientset) error {
 		"pulp_cr": pulp.newResourceName,
 	}
 	for k, v := range newLabels {
-		_, err := clientset.RESTClient().
-			Patch(types.MergePatchType).
-			AbsPath("/api/v1").
-			Namespace(pulp.oldSubscriptionNamespace).
-			Resource("services").
-			Name(pulp.oldDBSVC).
-			Param("fieldManager", "kubectl-label").
-			Body([]byte(`{"spec":{"selector":{"` + k + `":"` + v + `"}}}`)).
-			DoRaw(context.TODO())
-		if err != nil {
+		patch := client.RawPatch(types.MergePatchType, []byte(`{"spec":{"selector":{"`+k+`":"`+v+`"}}}`))
+		if err := pulp.patch(c, svc, patch, client.FieldOwner("kubectl-label")); err != nil {
 			fmt.Println("❌ Failed to add new labels to the Database Service:", err)
-			return err
+			return fmt.Errorf("failed to update service %s: %w", pulp.oldDBSVC, err)
 		}
 	}
 	return nil
 }
 
-func (pulp pulp) subscribe(clientset *kubernetes.Clientset) error {
+func (pulp pulp) subscribe(c cluster) error {
 	fmt.Println("Subscribing to the new Operator version ...")
 	newSubscription := &operatorsv1alpha1.Subscription{
 		TypeMeta: metav1.TypeMeta{
@@ -412,460 +364,350 @@ func (pulp pulp) subscribe(clientset *kubernetes.Clientset) error {
 	}
 	body, err := json.Marshal(newSubscription)
 	if err != nil {
-		fmt.Println("❌ Failed to serialize new Pulp CR:", err)
+		fmt.Println("❌ Failed to serialize new Subscription:", err)
 		return err
 	}
 	fmt.Println(string(body))
 
-	data, err := clientset.RESTClient().
-		Post().
-		AbsPath("/apis/operators.coreos.com/v1alpha1").
-		Namespace(pulp.newSubscriptionNamespace).
-		Resource("subscriptions").
-		Name(pulp.newSubscriptionName).
-		Body(body).
-		DoRaw(context.TODO())
+	err = pulp.create(c, newSubscription)
+
+	// in dry-run mode the old subscription was not deleted, so if both
+	// have the same name the API server will complain about it
+	if pulp.dryRun && apierrors.IsAlreadyExists(err) && pulp.newSubscriptionName == pulp.oldSubscriptionName {
+		fmt.Println("Subscription", pulp.newSubscriptionName, "will be created after the deletion of the current one")
+		return nil
+	}
 	if err != nil {
 		fmt.Println("❌ Failed to create Subscription:", err)
-		return err
+		return fmt.Errorf("failed to create subscription %s: %w", pulp.newSubscriptionName, err)
 	}
-
-	fmt.Println(string(data))
+	pulp.original.NewSubscriptionCreated = true
 	return nil
 }
 
-func (pulp pulp) convert(clientset *kubernetes.Clientset) error {
-	ctx := context.TODO()
-
-	fmt.Println("Converting Pulp CR to the new CRD ...")
-	data, err := clientset.RESTClient().
-		Get().
-		AbsPath("/apis/" + pulp.oldApi).
-		Namespace(pulp.oldSubscriptionNamespace).
-		Resource(pulp.oldResource).
-		Name(pulp.oldResourceName).
-		DoRaw(ctx)
+// toGolang maps the ansible CR into the golang Pulp CR.
+// ingressDomain is only used to build the route host when ingress_type is
+// route and no route_host was provided.
+func (pulp pulp) toGolang(convertSpec convertFunc, ingressDomain string) (*repomanagerv1alpha1.Pulp, []string) {
+	spec, warnings := convertSpec(pulp.Spec, conversion.ClusterInfo{
+		ResourceName:        pulp.oldResourceName,
+		Namespace:           pulp.oldSubscriptionNamespace,
+		DBPVC:               pulp.oldDBPVC,
+		IngressDomain:       ingressDomain,
+		ExternalDBSecret:    pulp.externalDBSecret,
+		RedisPVC:            pulp.oldRedisPVC,
+		ExternalCacheSecret: pulp.externalCacheSecret,
+		DBUser:              pulp.dbUser,
+		Endpoint:            pulp.endpoint,
+	})
+
+	return &repomanagerv1alpha1.Pulp{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: pulp.newApi,
+			Kind:       pulp.newKind,
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      pulp.newResourceName,
+			Namespace: pulp.newSubscriptionNamespace,
+		},
+		Spec: spec,
+	}, warnings
+}
 
+// formatReport returns the conversion report in the given format (text or json)
+func formatReport(report conversion.Report, format string) (string, error) {
+	if format != "json" {
+		return report.Text(), nil
+	}
+	data, err := json.MarshalIndent(report, "", "  ")
 	if err != nil {
-		fmt.Println("❌ Failed to find old Pulp CR:", err)
-		return err
+		return "", err
 	}
+	return string(data), nil
+}
 
-	json.Unmarshal(data, &pulp)
-
-	apiResources := corev1.ResourceRequirements{}
-	if pulp.Spec.Api.ResourceRequirements != nil {
-		apiResources = *pulp.Spec.Api.ResourceRequirements
-	}
-	contentResources := corev1.ResourceRequirements{}
-	if pulp.Spec.Content.ResourceRequirements != nil {
-		contentResources = *pulp.Spec.Content.ResourceRequirements
-	}
-	workerResources := corev1.ResourceRequirements{}
-	if pulp.Spec.Worker.ResourceRequirements != nil {
-		workerResources = *pulp.Spec.Worker.ResourceRequirements
-	}
-	webResources := corev1.ResourceRequirements{}
-	if pulp.Spec.Web.ResourceRequirements != nil {
-		webResources = *pulp.Spec.Web.ResourceRequirements
+// getAnsibleCR retrieves the ansible Pulp CR
+func (pulp *pulp) getAnsibleCR(c cluster) error {
+	kind, err := kindFor(c, pulp.oldApi, pulp.oldResource)
+	if err != nil {
+		fmt.Println("❌ Failed to find the "+pulp.oldResource+" resource in "+pulp.oldApi+":", err)
+		return fmt.Errorf("failed to find the %s resource in %s: %w", pulp.oldResource, pulp.oldApi, err)
 	}
-	dbResources := corev1.ResourceRequirements{}
-	if pulp.Spec.PostgresResourceRequirements != nil {
-		dbResources = *pulp.Spec.PostgresResourceRequirements
+	cr := newUnstructured(pulp.oldApi, kind)
+	err = c.Get(context.TODO(), client.ObjectKey{Namespace: pulp.oldSubscriptionNamespace, Name: pulp.oldResourceName}, cr)
+	if apierrors.IsNotFound(err) {
+		fmt.Println("❌ Old Pulp CR", pulp.oldResourceName, "not found in", pulp.oldSubscriptionNamespace, "namespace")
+		return fmt.Errorf("%s %s not found: %w", kind, pulp.oldResourceName, err)
+	} else if err != nil {
+		fmt.Println("❌ Failed to retrieve old Pulp CR:", err)
+		return fmt.Errorf("failed to get %s %s: %w", kind, pulp.oldResourceName, err)
 	}
 
-	apiStrategy := appsv1.DeploymentStrategy{}
-	if pulp.Spec.Api.Strategy != nil {
-		apiStrategy = *pulp.Spec.Api.Strategy
+	if err := fromUnstructured(cr.Object, pulp); err != nil {
+		fmt.Println("❌ Failed to read old Pulp CR:", err)
+		return fmt.Errorf("failed to read %s %s: %w", kind, pulp.oldResourceName, err)
 	}
-	contentStrategy := appsv1.DeploymentStrategy{}
-	if pulp.Spec.Content.Strategy != nil {
-		contentStrategy = *pulp.Spec.Content.Strategy
+	return nil
+}
+
+func (pulp pulp) convert(c cluster) error {
+	fmt.Println("Converting Pulp CR to the new CRD ...")
+	return pulp.createGolangCR(c, conversion.Convert)
+}
+
+// crd returns the converter of the ansible CR being migrated
+func (pulp *pulp) crd() crd {
+	if pulp.isGalaxy() {
+		return galaxy{*pulp}
 	}
-	workerStrategy := appsv1.DeploymentStrategy{}
-	if pulp.Spec.Worker.Strategy != nil {
-		workerStrategy = *pulp.Spec.Worker.Strategy
+	return *pulp
+}
+
+// createGolangCR creates the golang Pulp CR with the spec returned by convertSpec
+func (pulp pulp) createGolangCR(c cluster, convertSpec convertFunc) error {
+	if err := (&pulp).getAnsibleCR(c); err != nil {
+		return err
 	}
-	cacheStrategy := appsv1.DeploymentStrategy{}
-	if pulp.Spec.Web.Strategy != nil {
-		cacheStrategy = *pulp.Spec.Redis.Strategy
+	if !pulp.externalDB {
+		pulp.dbUser = pulp.getDBUser(c)
 	}
 
-	imagePullSecrets := pulp.Spec.ImagePullSecrets
-	if pulp.Spec.ImagePullSecret != "" {
-		imagePullSecrets = append(imagePullSecrets, pulp.Spec.ImagePullSecret)
+	endpoint, err := pulp.getEndpoint(c)
+	if err != nil {
+		fmt.Println("⚠️  Failed to find the live route or ingress, the spec will be used instead:", err)
+	} else if endpoint != nil {
+		fmt.Println("Migrator will keep the host and TLS settings of the live", strings.ToLower(endpoint.Kind), endpoint.Name)
+		pulp.endpoint = endpoint
 	}
 
-	pulpPVC := ""
-	if len(pulp.Spec.ObjectStorageAzureSecret) == 0 && len(pulp.Spec.ObjectStorageS3Secret) == 0 {
-		pulpPVC = pulp.oldResourceName + "-file-storage"
+	ingressDomain := ""
+	if pulp.Spec.IngressType == "route" && len(pulp.Spec.RouteHost) == 0 && pulp.endpoint == nil {
+		ingressDomain, _ = getDefaultIngressDomain(c)
 	}
-	redisPVC := pulp.oldResourceName + "-redis-data"
-
-	// Defining file_storage_class as "" to avoid conflict with pvc definition.
-	// In go version we are verifying multiple storage definitions,
-	// in ansible, when none of s3 or azure blob secrets are provided, the operator
-	// will provision a PVC. If a SC is provided, it will define the PVC spec with it,
-	// if not, no SC will be defined and k8s will try to use an available PV that fits
-	// the spec of the PVC.
-	fileStorageClass := ""
-	cacheStorageClass := ""
-	dbStorageClass := (*string)(nil)
-
-	// Rolling back this
-	/*
-		It is possible to set deployment_type: pulp, but deploy galaxy images (which is the default behavior, in both operators, when deployment_type is not provided).
-		The readiness and liveness probe from postgres sts is defined with a user based on deployment_type.
-		This is causing the following error when running migrator:
-		2023-01-03 18:24:06.002 UTC [456] FATAL:  password authentication failed for user "galaxy"
-		2023-01-03 18:24:06.002 UTC [456] DETAIL:  Role "galaxy" does not exist.
-				Connection matched pg_hba.conf line 90: "host	all         	all         	127.0.0.1/32        	scram-sha-256"
-		2023-01-03 18:24:15.990 UTC [474] FATAL:  password authentication failed for user "galaxy"
-		2023-01-03 18:24:15.990 UTC [474] DETAIL:  Role "galaxy" does not exist.
-				Connection matched pg_hba.conf line 90: "host	all         	all         	127.0.0.1/32        	scram-sha-256"
-		2023-01-03 18:24:16.002 UTC [475] FATAL:  password authentication failed for user "galaxy"
-		2023-01-03 18:24:16.002 UTC [475] DETAIL:  Role "galaxy" does not exist.
-				Connection matched pg_hba.conf line 90: "host	all         	all         	127.0.0.1/32        	scram-sha-256"
-	*/
-	/* deploymentType := "pulp"
-	if isGalaxy, _ := regexp.MatchString(".*galaxy.*", pulp.Spec.Image); isGalaxy {
-		deploymentType = "galaxy"
-	} */
-	deploymentType := pulp.Spec.DeploymentType
-
-	routeHost := pulp.Spec.RouteHost
-	if pulp.Spec.IngressType == "route" && len(pulp.Spec.RouteHost) == 0 {
-		ingressDomain, _ := getDefaultIngressDomain(clientset)
-		routeHost = pulp.oldResourceName + "-" + pulp.oldSubscriptionNamespace + "." + ingressDomain
+	pulpNew, warnings := pulp.toGolang(convertSpec, ingressDomain)
+	for _, warning := range warnings {
+		fmt.Println("⚠️ ", warning)
 	}
-
-	pulpNew := &repomanagerv1alpha1.Pulp{
-		TypeMeta: metav1.TypeMeta{
-			APIVersion: pulp.newApi,
-			Kind:       pulp.newKind,
-		},
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      pulp.newResourceName,
-			Namespace: pulp.newSubscriptionNamespace,
-		},
-		Spec: repomanagerv1alpha1.PulpSpec{
-			DeploymentType:           deploymentType,
-			FileStorageSize:          pulp.Spec.FileStorageSize,
-			FileStorageAccessMode:    pulp.Spec.FileStorageAccessMode,
-			FileStorageClass:         fileStorageClass,
-			PVC:                      pulpPVC,
-			ObjectStorageAzureSecret: pulp.Spec.ObjectStorageAzureSecret,
-			ObjectStorageS3Secret:    pulp.Spec.ObjectStorageS3Secret,
-			DBFieldsEncryptionSecret: pulp.Spec.DBFieldsEncryptionSecret,
-			SigningSecret:            pulp.Spec.SigningSecret,
-			SigningScriptsConfigmap:  pulp.Spec.SigningScriptsConfigmap,
-			StorageType:              pulp.Spec.StorageType,
-			IngressType:              pulp.Spec.IngressType,
-			IngressAnnotations:       pulp.Spec.IngressAnnotations,
-			IngressTLSSecret:         pulp.Spec.IngressTLSSecret,
-			RouteHost:                routeHost,
-			RouteTLSSecret:           pulp.Spec.RouteTLSSecret,
-			HAProxyTimeout:           pulp.Spec.HAProxyTimeout,
-			NginxMaxBodySize:         pulp.Spec.NginxMaxBodySize,
-			NginxProxyBodySize:       pulp.Spec.NginxMaxBodySize,
-			NginxProxyReadTimeout:    pulp.Spec.NginxProxyReadTimeout,
-			NginxProxyConnectTimeout: pulp.Spec.NginxProxyConnectTimeout,
-			NginxProxySendTimeout:    pulp.Spec.NginxProxySendTimeout,
-			ContainerTokenSecret:     pulp.Spec.ContainerTokenSecret,
-			Image:                    pulp.Spec.Image,
-			ImageVersion:             pulp.Spec.ImageVersion,
-			ImagePullPolicy:          pulp.Spec.ImagePullPolicy,
-			PulpSettings:             pulp.Spec.PulpSettings,
-			ImageWeb:                 pulp.Spec.ImageWeb,
-			ImageWebVersion:          pulp.Spec.ImageWebVersion,
-			AdminPasswordSecret:      pulp.Spec.AdminPasswordSecret,
-			ImagePullSecrets:         imagePullSecrets,
-			SSOSecret:                pulp.Spec.SSOSecret,
-			Api: repomanagerv1alpha1.Api{
-				Replicas:                  pulp.Spec.Api.Replicas,
-				Tolerations:               pulp.Spec.Tolerations,
-				TopologySpreadConstraints: pulp.Spec.TopologySpreadConstraints,
-				GunicornTimeout:           pulp.Spec.GunicornTimeout,
-				GunicornWorkers:           pulp.Spec.GunicornAPIWorkers,
-				ResourceRequirements:      apiResources,
-				ReadinessProbe:            nil,
-				LivenessProbe:             nil,
-				PDB:                       nil,
-				Strategy:                  apiStrategy,
-				//Affinity: pulp.Spec.Affinity,
-				//NodeSelector: pulp.Spec.NodeSelector,
-			},
-			Content: repomanagerv1alpha1.Content{
-				Replicas:                  pulp.Spec.Content.Replicas,
-				Tolerations:               pulp.Spec.Tolerations,
-				TopologySpreadConstraints: pulp.Spec.TopologySpreadConstraints,
-				GunicornTimeout:           pulp.Spec.GunicornTimeout,
-				GunicornWorkers:           pulp.Spec.GunicornContentWorkers,
-				ResourceRequirements:      contentResources,
-				ReadinessProbe:            nil,
-				LivenessProbe:             nil,
-				PDB:                       nil,
-				Strategy:                  contentStrategy,
-				//Affinity: pulp.Spec.Affinity,
-				//NodeSelector: pulp.Spec.NodeSelector,
-			},
-			Worker: repomanagerv1alpha1.Worker{
-				Replicas:                  pulp.Spec.Worker.Replicas,
-				Tolerations:               pulp.Spec.Tolerations,
-				TopologySpreadConstraints: pulp.Spec.TopologySpreadConstraints,
-				ResourceRequirements:      workerResources,
-				ReadinessProbe:            nil,
-				LivenessProbe:             nil,
-				PDB:                       nil,
-				Strategy:                  workerStrategy,
-				//Affinity: pulp.Spec.Affinity,
-				//NodeSelector: pulp.Spec.NodeSelector,
-			},
-			Web: repomanagerv1alpha1.Web{
-				Replicas:             pulp.Spec.Web.Replicas,
-				ResourceRequirements: webResources,
-				ReadinessProbe:       nil,
-				LivenessProbe:        nil,
-				PDB:                  nil,
-				//Affinity: pulp.Spec.Affinity,
-				//NodeSelector: pulp.Spec.NodeSelector,
-			},
-			Database: repomanagerv1alpha1.Database{
-				Affinity:                    nil,
-				PostgresImage:               pulp.Spec.PostgresImage,
-				PostgresExtraArgs:           pulp.Spec.PostgresExtraArgs,
-				PostgresDataPath:            pulp.Spec.PostgresDataPath,
-				PostgresInitdbArgs:          pulp.Spec.PostgresInitdbArgs,
-				PostgresHostAuthMethod:      pulp.Spec.PostgresHostAuthMethod,
-				ResourceRequirements:        dbResources,
-				PostgresStorageRequirements: pulp.Spec.PostgresStorageRequirements,
-				PostgresStorageClass:        dbStorageClass,
-				ReadinessProbe:              nil,
-				LivenessProbe:               nil,
-				PVC:                         pulp.oldDBPVC,
-				//ExternalDBSecret: "",
-				//PostgresVersion: "",
-				//PostgresPort: 5432,
-				//PostgresSSLMode: "prefer",
-				//NodeSelector:           pulp.Spec.PostgresSelector,
-				//Tolerations: pulp.Spec.PostgresToleration,
-			},
-			Cache: repomanagerv1alpha1.Cache{
-				RedisImage:                pulp.Spec.RedisImage,
-				RedisStorageClass:         cacheStorageClass,
-				RedisResourceRequirements: pulp.Spec.RedisResourceRequirements,
-				ReadinessProbe:            nil,
-				LivenessProbe:             nil,
-				Affinity:                  nil,
-				Tolerations:               nil,
-				NodeSelector:              nil,
-				Strategy:                  cacheStrategy,
-				PVC:                       redisPVC,
-				//ExternalCacheSecret: "",
-				//Enabled: true,
-				//RedisPort: 6379,
-			},
-		},
+	report, err := formatReport(conversion.NewReport(pulp.Spec, pulpNew.Spec, warnings), pulp.reportFormat)
+	if err != nil {
+		fmt.Println("❌ Failed to serialize the conversion report:", err)
+		return err
 	}
+	fmt.Println("📋 Conversion report:")
+	fmt.Println(report)
+
 	body, err := json.Marshal(pulpNew)
 	if err != nil {
 		fmt.Println("❌ Failed to serialize new Pulp CR:", err)
 		return err
 	}
+	cr, err := toUnstructured(pulpNew)
+	if err != nil {
+		fmt.Println("❌ Failed to serialize new Pulp CR:", err)
+		return err
+	}
 
 	fmt.Println("Create new CR:", string(body))
 
-	retries := 10
-	tried := 0
-	for ; tried < retries; tried++ {
-		if data, err = clientset.RESTClient().
-			Get().
-			AbsPath("/apis/" + pulp.newApi).
-			DoRaw(ctx); err != nil {
-			fmt.Println("Waiting for new CRD be created ... :", err)
-			time.Sleep(time.Second * 5)
-		} else {
-			fmt.Println("CRD:", string(data))
-			break
+	// in dry-run mode the new operator is not installed, so unless its CRD
+	// is already present there is nothing to validate the new CR against
+	if pulp.dryRun {
+		if installed, err := pulp.golangCRDInstalled(c, pulp.newKind); err != nil || !installed {
+			pulp.printPlan("POST", requestPath(c, cr, cr.GetNamespace(), ""), body)
+			return nil
 		}
+		if err := pulp.create(c, cr); err != nil {
+			fmt.Println("❌ Failed to create new Pulp CR:", err)
+			return fmt.Errorf("failed to create %s %s: %w", pulp.newKind, pulp.newResourceName, err)
+		}
+		return nil
 	}
 
-	if tried == 10 {
+	installed := false
+	for tried := 0; tried < 10 && !installed; tried++ {
+		if installed, err = pulp.golangCRDInstalled(c, pulp.newKind); err != nil {
+			fmt.Println("❌ Failed to find the golang CRD:", err)
+			return fmt.Errorf("failed to find the %s CRD: %w", pulp.newKind, err)
+		} else if !installed {
+			fmt.Println("Waiting for new CRD be created ...")
+			time.Sleep(time.Second * 5)
+		}
+	}
+	if !installed {
 		fmt.Println("❌ ERROR! Golang CRD not found!")
-		return err
+		return fmt.Errorf("%s CRD not found in %s", pulp.newKind, pulp.newApi)
 	}
 
-	_, err = clientset.RESTClient().
-		Post().
-		AbsPath("/apis/" + pulp.newApi + "/namespaces/" + pulp.newSubscriptionNamespace + "/" + pulp.newResource).
-		Body(body).
-		DoRaw(ctx)
-
-	if err != nil {
+	if err := pulp.create(c, cr); err != nil {
 		fmt.Println("❌ Failed to create new Pulp CR:", err)
-		return err
+		return fmt.Errorf("failed to create %s %s: %w", pulp.newKind, pulp.newResourceName, err)
 	}
+	pulp.original.GolangCRCreated = true
 	return nil
 }
 
-func main() {
-	config := ctrl.GetConfigOrDie()
-	clientset := kubernetes.NewForConfigOrDie(config)
-
-	// control var to run only convertion method
-	runOnlyConvertion := false
-	if strings.ToLower(os.Getenv("CONVERTION_ONLY")) == "true" {
-		runOnlyConvertion = true
-	}
-
-	// required variables
-	namespace := os.Getenv("PULP_NAMESPACE")
-	if namespace == "" {
-		fmt.Println("Missing definition of PULP_NAMESPACE env var!")
-		return
-	}
-	oldResourceName := os.Getenv("PULP_RESOURCE_NAME")
-	if oldResourceName == "" {
-		fmt.Println("Missing definition of PULP_RESOURCE_NAME")
-		return
+// golangCRDInstalled returns true if the API server serves the given kind of
+// the golang operator
+func (pulp pulp) golangCRDInstalled(c cluster, kind string) (bool, error) {
+	gv, err := schema.ParseGroupVersion(pulp.newApi)
+	if err != nil {
+		return false, err
 	}
-	newResourceName := os.Getenv("NEW_PULP_RESOURCE_NAME")
-	if newResourceName == "" {
-		newResourceName = oldResourceName
+	_, err = c.RESTMapper().RESTMapping(gv.WithKind(kind).GroupKind(), gv.Version)
+	if meta.IsNoMatchError(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
 	}
+	return true, nil
+}
 
-	// variables default values
-	oldSubscriptionName := os.Getenv("PULP_SUBSCRIPTION_NAME")
-	if oldSubscriptionName == "" {
-		oldSubscriptionName = "pulp-operator"
-	}
-	newSubscriptionName := os.Getenv("NEW_PULP_SUBSCRIPTION_NAME")
-	if newSubscriptionName == "" {
-		newSubscriptionName = oldSubscriptionName
-	}
-	newSubscriptionChannel := os.Getenv("NEW_SUBSCRIPTION_CHANNEL")
-	if newSubscriptionChannel == "" {
-		newSubscriptionChannel = "beta"
-	}
-	newSubscriptionInstallPlanApproval := os.Getenv("NEW_SUBSCRIPTION_INSTALL_PLAN_APPROVAL")
-	if newSubscriptionInstallPlanApproval == "" {
-		newSubscriptionInstallPlanApproval = "Automatic"
-	}
-	newSubscriptionSource := os.Getenv("NEW_SUBSCRIPTION_SOURCE")
-	if newSubscriptionSource == "" {
-		newSubscriptionSource = "community-operators"
-	}
-	newSubscriptionSourceNamespace := os.Getenv("NEW_SUBSCRIPTION_SOURCE_NAMESPACE")
-	if newSubscriptionSourceNamespace == "" {
-		newSubscriptionSourceNamespace = "openshift-marketplace"
-	}
-	newSubscriptionStartingCSV := os.Getenv("NEW_SUBSCRIPTION_STARTING_CSV")
-	if newSubscriptionStartingCSV == "" {
-		newSubscriptionStartingCSV = "pulp-operator.v1.0.0-alpha.5"
-	}
-	newApi := os.Getenv("NEW_PULP_API")
-	if newApi == "" {
-		newApi = "repo-manager.pulpproject.org/v1alpha1"
+func main() {
+	if err := run(os.Args[1:]); err != nil {
+		os.Exit(1)
 	}
-	oldApi := os.Getenv("PULP_API")
-	if oldApi == "" {
-		oldApi = "pulp.pulpproject.org/v1beta1"
+}
+
+// prepare retrieves the ansible Pulp CR and the progress of a previous run,
+// and finds out which resources are managed by the ansible operator
+func (pulp *pulp) prepare(c cluster) error {
+	if err := pulp.loadCheckpoint(c); err != nil {
+		return err
 	}
-	newKind := os.Getenv("NEW_PULP_KIND")
-	if newKind == "" {
-		newKind = "Pulp"
+
+	// the database pods are only migrated if they were deployed by the operator
+	if err := pulp.getAnsibleCR(c); err != nil {
+		return err
 	}
-	oldResource := os.Getenv("PULP_RESOURCE")
-	if oldResource == "" {
-		oldResource = "pulps"
+	if err := pulp.detectOLM(c); err != nil {
+		return err
 	}
-	newResource := os.Getenv("NEW_PULP_RESOURCE")
-	if newResource == "" {
-		newResource = oldResource
+	if err := pulp.detectExternalDB(c); err != nil {
+		return err
 	}
+	return pulp.detectExternalCache()
+}
 
-	ansiblePulp := pulp{
-		oldSubscriptionName:                oldSubscriptionName,
-		oldSubscriptionNamespace:           namespace,
-		newSubscriptionNamespace:           namespace,
-		newSubscriptionName:                newSubscriptionName,
-		newSubscriptionChannel:             newSubscriptionChannel,
-		newSubscriptionInstallPlanApproval: newSubscriptionInstallPlanApproval,
-		newSubscriptionSource:              newSubscriptionSource,
-		newSubscriptionSourceNamespace:     newSubscriptionSourceNamespace,
-		newSubscriptionStartingCSV:         newSubscriptionStartingCSV,
-		newApi:                             newApi,
-		newKind:                            newKind,
-		newResourceName:                    newResourceName,
-		newResource:                        newResource,
-		oldApi:                             oldApi,
-		oldResource:                        oldResource,
-		oldResourceName:                    oldResourceName,
+// migrationSteps returns the steps run by the migration, in order
+func (pulp *pulp) migrationSteps(c cluster, runOnlyConvertion bool) []migrationStep {
+	steps := []migrationStep{}
+	if !pulp.externalDB {
+		steps = append(steps, migrationStep{"getCurrentDBPVC", func() error { return pulp.getCurrentDBPVC(c) }})
 	}
-
-	if err := (&ansiblePulp).getCurrentDBPVC(clientset); err != nil {
-		return
+	if !pulp.externalCache {
+		steps = append(steps, migrationStep{"getCurrentRedisPVC", func() error { return pulp.getCurrentRedisPVC(c) }})
 	}
-
 	if !runOnlyConvertion {
-		if err := (&ansiblePulp).getCurrentDBService(clientset); err != nil {
-			return
+		if !pulp.externalDB {
+			steps = append(steps, []migrationStep{
+				{"getCurrentDBService", func() error { return pulp.getCurrentDBService(c) }},
+				{"getCurrentDBSts", func() error { return pulp.getCurrentDBSts(c) }},
+			}...)
 		}
-
-		if err := (&ansiblePulp).getCurrentDBSts(clientset); err != nil {
-			return
+		if pulp.backupMethod != backupNone {
+			steps = append(steps, migrationStep{"preMigrationBackup", func() error { return pulp.preMigrationBackup(c) }})
 		}
-
-		csvName, err := ansiblePulp.getCurrentCSV(clientset)
-		if err != nil {
-			return
+		// the catalog is ready before the ansible operator is removed
+		if !pulp.sharedSubscription && !pulp.installManifests && pulp.indexImage != "" {
+			steps = append(steps, []migrationStep{
+				{"createCatalogSource", func() error { return pulp.createCatalogSource(c) }},
+				{"waitForCatalogSource", func() error { return pulp.waitForCatalogSource(c) }},
+			}...)
 		}
-
-		if err := ansiblePulp.deleteSubscription(clientset); err != nil {
-			return
+		if !pulp.sharedSubscription && pulp.withoutOLM {
+			steps = append(steps, []migrationStep{
+				{"getAnsibleOperator", func() error { return pulp.getAnsibleOperator(c) }},
+				{"deleteAnsibleOperator", func() error { return pulp.deleteAnsibleOperator(c) }},
+			}...)
+		} else if !pulp.sharedSubscription {
+			steps = append(steps, []migrationStep{
+				{"getCurrentCSV", func() error {
+					_, err := pulp.getCurrentCSV(c)
+					return err
+				}},
+				{"deleteSubscription", func() error { return pulp.deleteSubscription(c) }},
+				{"deleteCSV", func() error { return pulp.deleteCSV(c, pulp.original.CSVName) }},
+			}...)
 		}
-
-		if err := ansiblePulp.deleteCSV(clientset, csvName); err != nil {
-			return
+		steps = append(steps, migrationStep{"deleteDeployments", func() error { return pulp.deleteDeployments(c) }})
+		if !pulp.externalDB {
+			steps = append(steps, []migrationStep{
+				{"downscaleDBReplicas", func() error { return pulp.downscaleDBReplicas(c) }},
+				{"updateDBService", func() error { return pulp.updateDBService(c) }},
+			}...)
 		}
-
-		if err := ansiblePulp.deleteDeployments(clientset); err != nil {
-			return
+		if !pulp.sharedSubscription && pulp.installManifests {
+			steps = append(steps, []migrationStep{
+				{"applyOperatorManifests", func() error { return pulp.applyOperatorManifests(c) }},
+				{"waitForOperatorDeployment", func() error { return pulp.waitForOperatorDeployment(c) }},
+			}...)
+		} else if !pulp.sharedSubscription {
+			steps = append(steps, []migrationStep{
+				{"prepareOperatorGroup", func() error { return pulp.prepareOperatorGroup(c) }},
+				{"subscribe", func() error { return pulp.subscribe(c) }},
+				{"waitForOperator", func() error { return pulp.waitForOperator(c) }},
+			}...)
 		}
+	}
+	if pulp.externalDB {
+		steps = append(steps, migrationStep{"convertExternalDBSecret", func() error { return pulp.convertExternalDBSecret(c) }})
+	}
+	if pulp.externalCache {
+		steps = append(steps, migrationStep{"createExternalCacheSecret", func() error { return pulp.createExternalCacheSecret(c) }})
+	}
+	steps = append(steps, migrationStep{"convert", func() error { return pulp.crd().convert(c) }})
+	// in conversion-only mode the golang operator could still be missing
+	if !runOnlyConvertion && pulp.verifyTimeout > 0 {
+		steps = append(steps, migrationStep{"verify", func() error { return pulp.verify(c) }})
+	}
+	steps = append(steps, migrationStep{"convertBackups", func() error { return pulp.convertBackups(c) }})
+	return steps
+}
 
-		if err := ansiblePulp.downscaleDBReplicas(clientset); err != nil {
-			return
-		}
+// migrate runs the migration steps not completed in a previous run
+func (pulp *pulp) migrate(c cluster, opts *options) error {
+	pulp.skipCheckpoint = opts.conversionOnly
+	if err := pulp.prepare(c); err != nil {
+		return err
+	}
 
-		if err := ansiblePulp.updateDBService(clientset); err != nil {
-			return
+	// pre-flight checks are only meaningful before anything was changed
+	if !opts.skipPreflight && len(pulp.checkpoint.completedSteps) == 0 {
+		if err := pulp.preflight(c, opts.conversionOnly); err != nil {
+			return err
 		}
+	}
 
-		if err := ansiblePulp.subscribe(clientset); err != nil {
-			return
+	if err := pulp.runSteps(c, pulp.migrationSteps(c, opts.conversionOnly)); err != nil {
+		// restore whatever was already changed
+		if pulp.dryRun || !pulp.rollbackOnFailure || errors.Is(err, errVerificationFailed) {
+			return err
 		}
+		if err := pulp.rollback(c); err != nil {
+			fmt.Println("❌ Failed to rollback the migration, the resources should be restored manually:", err)
+			return err
+		}
+		// everything is back to the original state, so there is nothing to resume
+		pulp.deleteCheckpoint(c)
+		return err
 	}
 
-	if err := ansiblePulp.convert(clientset); err != nil {
-		return
+	if pulp.dryRun {
+		fmt.Println("✅ Dry-run finished, no changes were made")
+	} else if pulp.skipCheckpoint {
+		fmt.Println("✅ Conversion finished")
 	} else {
 		fmt.Println("✅ Migration finished")
+		fmt.Println("The migration state is kept in the", pulp.checkpointName(), "ConfigMap, remove it to run a new migration")
 	}
-
+	return nil
 }
 
-func getDefaultIngressDomain(clientset *kubernetes.Clientset) (string, error) {
-
-	defaultIngressDomain, err := clientset.RESTClient().
-		Get().
-		AbsPath("/apis/config.openshift.io/v1/ingresses/cluster").
-		DoRaw(context.TODO())
-	if err != nil {
+func getDefaultIngressDomain(c cluster) (string, error) {
+	ingress := &configv1.Ingress{}
+	if err := c.Get(context.TODO(), client.ObjectKey{Name: "cluster"}, ingress); err != nil {
 		fmt.Println("❌ Failed to find the cluster default ingress domain:", err)
-		return "", err
+		return "", fmt.Errorf("failed to get the cluster ingress configuration: %w", err)
 	}
-
-	ingress := &configv1.Ingress{}
-	json.Unmarshal(defaultIngressDomain, ingress)
 	return ingress.Spec.Domain, nil
 }
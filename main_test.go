@@ -0,0 +1,1140 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	configv1 "github.com/openshift/api/config/v1"
+	routev1 "github.com/openshift/api/route/v1"
+	operatorsv1 "github.com/operator-framework/api/pkg/operators/v1"
+	operatorsv1alpha1 "github.com/operator-framework/api/pkg/operators/v1alpha1"
+	repomanagerv1alpha1 "github.com/pulp/pulp-operator/api/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+)
+
+// the ansible installation seeded by ansibleInstall
+const (
+	testNamespace = "pulp"
+	testCSV       = "pulp-operator.v0.14.0"
+	testDBPVC     = "postgres-example-pulp-postgres-13-0"
+	testDBSts     = "example-pulp-postgres-13"
+	testRedisPVC  = "example-pulp-redis-data"
+)
+
+var (
+	testDBLabels    = ansibleDBLabels("example-pulp")
+	testDeployments = ansibleDeployments("example-pulp")
+)
+
+// ansibleDBLabels returns the labels of the database of an ansible Pulp CR
+func ansibleDBLabels(name string) map[string]string {
+	return map[string]string{
+		"app.kubernetes.io/instance":   "postgres-" + name,
+		"app.kubernetes.io/component":  "database",
+		"app.kubernetes.io/managed-by": "pulp-operator",
+	}
+}
+
+// ansibleDeployments returns the deployments of an ansible Pulp CR, by name,
+// with their component
+func ansibleDeployments(name string) map[string]string {
+	return map[string]string{
+		name + "-api":     "api",
+		name + "-content": "content-server",
+		name + "-worker":  "worker",
+		name + "-web":     "webserver",
+		name + "-redis":   "cache",
+	}
+}
+
+// ansibleInstall returns the objects of a Pulp CR deployed by the ansible
+// operator through OLM, and the catalog of the golang operator
+func ansibleInstall() []client.Object {
+	objs := []client.Object{
+		&operatorsv1alpha1.Subscription{
+			ObjectMeta: metav1.ObjectMeta{Name: "pulp-operator", Namespace: testNamespace},
+			Spec: &operatorsv1alpha1.SubscriptionSpec{
+				Package:                "pulp-operator",
+				Channel:                "alpha",
+				CatalogSource:          "community-operators",
+				CatalogSourceNamespace: "openshift-marketplace",
+			},
+			Status: operatorsv1alpha1.SubscriptionStatus{CurrentCSV: testCSV, InstalledCSV: testCSV},
+		},
+		&operatorsv1alpha1.ClusterServiceVersion{
+			ObjectMeta: metav1.ObjectMeta{Name: testCSV, Namespace: testNamespace},
+			Status:     operatorsv1alpha1.ClusterServiceVersionStatus{Phase: operatorsv1alpha1.CSVPhaseSucceeded},
+		},
+		&operatorsv1.OperatorGroup{
+			ObjectMeta: metav1.ObjectMeta{Name: "pulp-operator-group", Namespace: testNamespace},
+			Spec:       operatorsv1.OperatorGroupSpec{TargetNamespaces: []string{testNamespace}},
+		},
+		&operatorsv1alpha1.CatalogSource{
+			ObjectMeta: metav1.ObjectMeta{Name: "community-operators", Namespace: "openshift-marketplace"},
+		},
+		&unstructured.Unstructured{Object: map[string]any{
+			"apiVersion": "packages.operators.coreos.com/v1",
+			"kind":       "PackageManifest",
+			"metadata": map[string]any{
+				"name":      "pulp-operator",
+				"namespace": testNamespace,
+				"labels":    map[string]any{"catalog": "community-operators", "catalog-namespace": "openshift-marketplace"},
+			},
+			"status": map[string]any{
+				"channels": []any{map[string]any{
+					"name":       "beta",
+					"currentCSV": "pulp-operator.v1.0.0-alpha.5",
+					"currentCSVDesc": map[string]any{"installModes": []any{
+						map[string]any{"type": "OwnNamespace", "supported": true},
+						map[string]any{"type": "SingleNamespace", "supported": true},
+						map[string]any{"type": "MultiNamespace", "supported": false},
+						map[string]any{"type": "AllNamespaces", "supported": false},
+					}},
+				}},
+			},
+		}},
+		&configv1.Ingress{
+			ObjectMeta: metav1.ObjectMeta{Name: "cluster"},
+			Spec:       configv1.IngressSpec{Domain: "apps.example.com"},
+		},
+	}
+	return append(ansibleInstance("example-pulp"), objs...)
+}
+
+// ansibleInstance returns the objects deployed by the ansible operator for
+// the Pulp CR with the given name
+func ansibleInstance(name string) []client.Object {
+	replicas := int32(1)
+	dbLabels := ansibleDBLabels(name)
+	objs := []client.Object{
+		&unstructured.Unstructured{Object: map[string]any{
+			"apiVersion": "pulp.pulpproject.org/v1beta1",
+			"kind":       "Pulp",
+			"metadata":   map[string]any{"name": name, "namespace": testNamespace},
+			"spec": map[string]any{
+				"admin_password_secret":    name + "-admin-password",
+				"file_storage_access_mode": "ReadWriteMany",
+				"file_storage_size":        "10Gi",
+				"ingress_type":             "route",
+				"storage_type":             "File",
+			},
+			"status": map[string]any{
+				"conditions": []any{map[string]any{"type": "Successful", "status": "True"}},
+			},
+		}},
+		&corev1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{Name: "postgres-" + name + "-postgres-13-0", Namespace: testNamespace, Labels: dbLabels},
+		},
+		&corev1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{Name: name + "-redis-data", Namespace: testNamespace},
+		},
+		&corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: name + "-postgres-13", Namespace: testNamespace, Labels: dbLabels},
+			Spec:       corev1.ServiceSpec{Selector: dbLabels},
+		},
+		&appsv1.StatefulSet{
+			ObjectMeta: metav1.ObjectMeta{Name: name + "-postgres-13", Namespace: testNamespace, Labels: dbLabels},
+			Spec: appsv1.StatefulSetSpec{
+				Replicas: &replicas,
+				Selector: &metav1.LabelSelector{MatchLabels: dbLabels},
+			},
+		},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: name + "-postgres-configuration", Namespace: testNamespace},
+			Data:       map[string][]byte{"username": []byte("pulp"), "type": []byte("managed")},
+		},
+	}
+	for deployment, component := range ansibleDeployments(name) {
+		labels := map[string]string{"app.kubernetes.io/component": component, "app.kubernetes.io/managed-by": "pulp-operator"}
+		objs = append(objs, &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: deployment, Namespace: testNamespace, Labels: labels},
+			Spec: appsv1.DeploymentSpec{
+				Replicas: &replicas,
+				Selector: &metav1.LabelSelector{MatchLabels: labels},
+			},
+		})
+	}
+	return objs
+}
+
+// testOptions returns the options of a migration of the ansibleInstall Pulp CR
+func testOptions(t *testing.T) *options {
+	flags, opts := newFlagSet("migrate")
+	if err := flags.Parse([]string{"-namespace", testNamespace, "-name", "example-pulp"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := opts.validate(); err != nil {
+		t.Fatal(err)
+	}
+	return opts
+}
+
+// get retrieves an object that should exist
+func get(t *testing.T, c cluster, namespace, name string, obj client.Object) {
+	t.Helper()
+	if err := c.Get(context.TODO(), client.ObjectKey{Namespace: namespace, Name: name}, obj); err != nil {
+		t.Fatalf("failed to get %T %s: %v", obj, name, err)
+	}
+}
+
+// assertNotFound verifies that an object does not exist
+func assertNotFound(t *testing.T, c cluster, namespace, name string, obj client.Object) {
+	t.Helper()
+	err := c.Get(context.TODO(), client.ObjectKey{Namespace: namespace, Name: name}, obj)
+	if !apierrors.IsNotFound(err) {
+		t.Errorf("expected %T %s to be not found, got %v", obj, name, err)
+	}
+}
+
+// assertMigrated verifies that the installation is handed over to the golang operator
+func assertMigrated(t *testing.T, c cluster, opts *options) {
+	t.Helper()
+	cr := newUnstructured(opts.newApi, opts.newKind)
+	get(t, c, testNamespace, "example-pulp", cr)
+	pulpNew := &repomanagerv1alpha1.Pulp{}
+	if err := fromUnstructured(cr.Object, pulpNew); err != nil {
+		t.Fatal(err)
+	}
+	if pulpNew.Spec.Database.PVC != testDBPVC {
+		t.Errorf("golang Pulp CR database.pvc = %q, expected %q", pulpNew.Spec.Database.PVC, testDBPVC)
+	}
+	if pulpNew.Spec.Cache.PVC != testRedisPVC {
+		t.Errorf("golang Pulp CR cache.pvc = %q, expected %q", pulpNew.Spec.Cache.PVC, testRedisPVC)
+	}
+
+	// the golang operator deployments have the same names as the ansible ones
+	deployments := &appsv1.DeploymentList{}
+	if err := c.List(context.TODO(), deployments, client.InNamespace(testNamespace), client.MatchingLabels{"app.kubernetes.io/managed-by": "pulp-operator"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, deployment := range deployments.Items {
+		if _, found := testDeployments[deployment.Name]; found {
+			t.Errorf("found ansible deployment %s, expected it to be deleted", deployment.Name)
+		}
+	}
+
+	sts := &appsv1.StatefulSet{}
+	get(t, c, testNamespace, testDBSts, sts)
+	if *sts.Spec.Replicas != 0 {
+		t.Errorf("database statefulset replicas = %d, expected 0", *sts.Spec.Replicas)
+	}
+	svc := &corev1.Service{}
+	get(t, c, testNamespace, testDBSts, svc)
+	if expected := map[string]string{"app": "postgresql", "pulp_cr": "example-pulp"}; !reflect.DeepEqual(svc.Spec.Selector, expected) {
+		t.Errorf("database service selector = %v, expected %v", svc.Spec.Selector, expected)
+	}
+
+	cm := &corev1.ConfigMap{}
+	get(t, c, testNamespace, "example-pulp-migrator-state", cm)
+	if steps := cm.Data["completedSteps"]; !strings.HasSuffix(steps, ",convert,verify,convertBackups") {
+		t.Errorf("completed steps = %s, expected every step", steps)
+	}
+}
+
+// assertSubscribed verifies that the ansible operator Subscription was
+// replaced by the golang operator one
+func assertSubscribed(t *testing.T, c cluster, opts *options) {
+	t.Helper()
+	sub := &operatorsv1alpha1.Subscription{}
+	get(t, c, testNamespace, "pulp-operator", sub)
+	if sub.Spec.StartingCSV != opts.startingCSV {
+		t.Errorf("subscription startingCSV = %q, expected %q", sub.Spec.StartingCSV, opts.startingCSV)
+	}
+	assertNotFound(t, c, testNamespace, testCSV, &operatorsv1alpha1.ClusterServiceVersion{})
+}
+
+// assertUnchanged verifies that the ansible installation is running as
+// before the migration
+func assertUnchanged(t *testing.T, c cluster, opts *options) {
+	t.Helper()
+	assertNotFound(t, c, testNamespace, "example-pulp", newUnstructured(opts.newApi, opts.newKind))
+	assertNotFound(t, c, testNamespace, "example-pulp-database-0", &corev1.Pod{})
+	assertNotFound(t, c, testNamespace, "example-pulp-migrator-state", &corev1.ConfigMap{})
+
+	sub := &operatorsv1alpha1.Subscription{}
+	get(t, c, testNamespace, "pulp-operator", sub)
+	if sub.Spec.StartingCSV == opts.startingCSV {
+		t.Errorf("subscription startingCSV = %q, expected the ansible operator", sub.Spec.StartingCSV)
+	}
+	get(t, c, testNamespace, testCSV, &operatorsv1alpha1.ClusterServiceVersion{})
+	assertNotFound(t, c, testNamespace, opts.startingCSV, &operatorsv1alpha1.ClusterServiceVersion{})
+	for name := range testDeployments {
+		get(t, c, testNamespace, name, &appsv1.Deployment{})
+	}
+
+	sts := &appsv1.StatefulSet{}
+	get(t, c, testNamespace, testDBSts, sts)
+	if *sts.Spec.Replicas != 1 {
+		t.Errorf("database statefulset replicas = %d, expected 1", *sts.Spec.Replicas)
+	}
+	svc := &corev1.Service{}
+	get(t, c, testNamespace, testDBSts, svc)
+	if !reflect.DeepEqual(svc.Spec.Selector, testDBLabels) {
+		t.Errorf("database service selector = %v, expected %v", svc.Spec.Selector, testDBLabels)
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	c := newFakeCluster(ansibleInstall()...)
+	opts := testOptions(t)
+	if err := opts.newPulp().migrate(c, opts); err != nil {
+		t.Fatalf("migrate() = %v", err)
+	}
+	assertMigrated(t, c, opts)
+	assertSubscribed(t, c, opts)
+}
+
+// TestMigrateSharedNamespace verifies that only the resources of the migrated
+// Pulp CR are changed when another one is deployed in the same namespace,
+// even if its names start with the name of the migrated one
+func TestMigrateSharedNamespace(t *testing.T) {
+	c := newFakeCluster(append(ansibleInstall(), ansibleInstance("example-pulp-2")...)...)
+	opts := testOptions(t)
+	if err := opts.newPulp().migrate(c, opts); err != nil {
+		t.Fatalf("migrate() = %v", err)
+	}
+	assertMigrated(t, c, opts)
+
+	for name := range ansibleDeployments("example-pulp-2") {
+		get(t, c, testNamespace, name, &appsv1.Deployment{})
+	}
+	sts := &appsv1.StatefulSet{}
+	get(t, c, testNamespace, "example-pulp-2-postgres-13", sts)
+	if *sts.Spec.Replicas != 1 {
+		t.Errorf("example-pulp-2 database statefulset replicas = %d, expected 1", *sts.Spec.Replicas)
+	}
+	svc := &corev1.Service{}
+	get(t, c, testNamespace, "example-pulp-2-postgres-13", svc)
+	if expected := ansibleDBLabels("example-pulp-2"); !reflect.DeepEqual(svc.Spec.Selector, expected) {
+		t.Errorf("example-pulp-2 database service selector = %v, expected %v", svc.Spec.Selector, expected)
+	}
+}
+
+// TestMigrateDBNotFound verifies that the database of another Pulp CR is not
+// taken for the one being migrated
+func TestMigrateDBNotFound(t *testing.T) {
+	objs := []client.Object{}
+	for _, obj := range ansibleInstall() {
+		switch obj.(type) {
+		case *appsv1.StatefulSet, *corev1.Service:
+			continue
+		}
+		objs = append(objs, obj)
+	}
+	c := newFakeCluster(append(objs, ansibleInstance("example-pulp-2")...)...)
+	opts := testOptions(t)
+	if err := opts.newPulp().migrate(c, opts); err == nil {
+		t.Fatal("migrate() succeeded without the database of the Pulp CR")
+	}
+	assertNotFound(t, c, testNamespace, "example-pulp", newUnstructured(opts.newApi, opts.newKind))
+	sts := &appsv1.StatefulSet{}
+	get(t, c, testNamespace, "example-pulp-2-postgres-13", sts)
+	if *sts.Spec.Replicas != 1 {
+		t.Errorf("example-pulp-2 database statefulset replicas = %d, expected 1", *sts.Spec.Replicas)
+	}
+}
+
+func TestMigrateDryRun(t *testing.T) {
+	c := newFakeCluster(ansibleInstall()...)
+	opts := testOptions(t)
+	opts.dryRun = true
+	if err := opts.newPulp().migrate(c, opts); err != nil {
+		t.Fatalf("migrate() = %v", err)
+	}
+	assertUnchanged(t, c, opts)
+}
+
+func TestRequestPath(t *testing.T) {
+	c := newFakeClusterWithoutOLM()
+	tests := []struct {
+		obj      client.Object
+		name     string
+		expected string
+	}{
+		{&corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: "example-pulp-postgres-13", Namespace: testNamespace}}, "example-pulp-postgres-13", "/api/v1/namespaces/pulp/services/example-pulp-postgres-13"},
+		{&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace}}, "", "/apis/apps/v1/namespaces/pulp/deployments"},
+		{&rbacv1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: "view", Namespace: testNamespace}}, "view", "/apis/rbac.authorization.k8s.io/v1/clusterroles/view"},
+		// not served, so the resource is guessed from the kind
+		{&operatorsv1alpha1.Subscription{ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace}}, "", "/apis/operators.coreos.com/v1alpha1/namespaces/pulp/subscriptions"},
+	}
+	for _, tt := range tests {
+		if path := requestPath(c, tt.obj, tt.obj.GetNamespace(), tt.name); path != tt.expected {
+			t.Errorf("requestPath(%T) = %s, expected %s", tt.obj, path, tt.expected)
+		}
+	}
+}
+
+func TestMigrateRollback(t *testing.T) {
+	tests := []struct {
+		step      string
+		failOn    string
+		failAfter int
+	}{
+		{"getCurrentDBPVC", "list PersistentVolumeClaim", 0},
+		{"getCurrentRedisPVC", "get PersistentVolumeClaim", 0},
+		{"getCurrentDBService", "list Service", 0},
+		{"getCurrentDBSts", "list StatefulSet", 0},
+		{"getCurrentCSV", "get Subscription", 0},
+		{"deleteSubscription", "delete Subscription", 0},
+		{"deleteCSV", "delete ClusterServiceVersion", 0},
+		{"deleteDeployments", "delete Deployment", 0},
+		{"downscaleDBReplicas", "patch StatefulSet", 0},
+		{"updateDBService", "patch Service", 0},
+		{"prepareOperatorGroup", "list OperatorGroup", 0},
+		{"subscribe", "create Subscription", 0},
+		{"waitForOperator", "get ClusterServiceVersion", 0},
+		{"convert", "create Pulp", 0},
+		{"saveCheckpoint", "update ConfigMap", 0},
+		// the checkpoint saved after convert, the golang Pulp CR is deleted
+		{"saveCheckpoint after convert", "update ConfigMap", 12},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.step, func(t *testing.T) {
+			c := newFakeCluster(ansibleInstall()...)
+			c.failOn, c.failAfter = tt.failOn, tt.failAfter
+			opts := testOptions(t)
+			opts.skipPreflight = true
+			if err := opts.newPulp().migrate(c, opts); err == nil {
+				t.Fatal("migrate() succeeded, expected the injected failure")
+			}
+			if c.failOn != "" {
+				t.Fatalf("%s was never requested", tt.failOn)
+			}
+			assertUnchanged(t, c, opts)
+		})
+	}
+}
+
+// TestMigratePermissions verifies that the pre-flight checks fail before
+// anything is changed when a request of the migration is not allowed
+func TestMigratePermissions(t *testing.T) {
+	// deleteDeployments deletes the deployments, deleteCheckpoint the
+	// ConfigMap, verify proxies the status endpoint, convertBackups lists the
+	// backups and rollback deletes the golang Pulp CR
+	for _, forbidden := range []string{"delete deployments", "delete configmaps", "get services", "list pulpbackups", "delete pulps"} {
+		t.Run(forbidden, func(t *testing.T) {
+			c := newFakeCluster(ansibleInstall()...)
+			c.forbidden = []string{forbidden}
+			opts := testOptions(t)
+			if err := opts.newPulp().migrate(c, opts); err == nil {
+				t.Fatal("migrate() succeeded, expected the pre-flight checks to fail")
+			}
+			assertUnchanged(t, c, opts)
+		})
+	}
+}
+
+// TestMigrateExternalDB verifies that a postgres_configuration_secret without
+// type points to an external database when there is no database StatefulSet
+func TestMigrateExternalDB(t *testing.T) {
+	objs := []client.Object{}
+	for _, obj := range ansibleInstall() {
+		switch obj := obj.(type) {
+		case *appsv1.StatefulSet, *corev1.Service:
+		case *corev1.PersistentVolumeClaim:
+			if obj.Name != testDBPVC {
+				objs = append(objs, obj)
+			}
+		case *unstructured.Unstructured:
+			if obj.GetKind() == "Pulp" {
+				unstructured.SetNestedField(obj.Object, "example-pulp-external-db", "spec", "postgres_configuration_secret")
+			}
+			objs = append(objs, obj)
+		default:
+			objs = append(objs, obj)
+		}
+	}
+	objs = append(objs, &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "example-pulp-external-db", Namespace: testNamespace},
+		Data: map[string][]byte{
+			"host":     []byte("postgres.example.com"),
+			"port":     []byte("5432"),
+			"username": []byte("pulp"),
+			"password": []byte("password"),
+			"database": []byte("pulp"),
+			"sslmode":  []byte("require"),
+		},
+	})
+	c := newFakeCluster(objs...)
+	opts := testOptions(t)
+	if err := opts.newPulp().migrate(c, opts); err != nil {
+		t.Fatalf("migrate() = %v", err)
+	}
+
+	cr := newUnstructured(opts.newApi, opts.newKind)
+	get(t, c, testNamespace, "example-pulp", cr)
+	pulpNew := &repomanagerv1alpha1.Pulp{}
+	if err := fromUnstructured(cr.Object, pulpNew); err != nil {
+		t.Fatal(err)
+	}
+	if pulpNew.Spec.Database.ExternalDBSecret != "example-pulp-external-database" {
+		t.Errorf("golang Pulp CR database.external_db_secret = %q, expected example-pulp-external-database", pulpNew.Spec.Database.ExternalDBSecret)
+	}
+	secret := &corev1.Secret{}
+	get(t, c, testNamespace, "example-pulp-external-database", secret)
+	if host := string(secret.Data["POSTGRES_HOST"]); host != "postgres.example.com" {
+		t.Errorf("external database secret POSTGRES_HOST = %q, expected postgres.example.com", host)
+	}
+}
+
+// TestMigrateConversionOnly verifies that a conversion-only run does not
+// leave a migration state that a later migration would resume from
+func TestMigrateConversionOnly(t *testing.T) {
+	c := newFakeCluster(ansibleInstall()...)
+	// the ansible deployments are still there, so the golang operator is not
+	// running yet
+	c.operatorDown = true
+	opts := testOptions(t)
+	opts.conversionOnly = true
+	if err := opts.newPulp().migrate(c, opts); err != nil {
+		t.Fatalf("conversion-only migrate() = %v", err)
+	}
+	cr := newUnstructured(opts.newApi, opts.newKind)
+	get(t, c, testNamespace, "example-pulp", cr)
+	assertNotFound(t, c, testNamespace, "example-pulp-migrator-state", &corev1.ConfigMap{})
+
+	if err := c.Delete(context.TODO(), cr); err != nil {
+		t.Fatal(err)
+	}
+	c.operatorDown = false
+	opts.conversionOnly = false
+	if err := opts.newPulp().migrate(c, opts); err != nil {
+		t.Fatalf("migrate() = %v", err)
+	}
+	assertMigrated(t, c, opts)
+	assertSubscribed(t, c, opts)
+}
+
+func TestMigrateResume(t *testing.T) {
+	c := newFakeCluster(ansibleInstall()...)
+	c.failOn = "patch Service"
+	opts := testOptions(t)
+	opts.rollbackOnFailure = false
+	if err := opts.newPulp().migrate(c, opts); err == nil {
+		t.Fatal("migrate() succeeded, expected the injected failure")
+	}
+
+	cm := &corev1.ConfigMap{}
+	get(t, c, testNamespace, "example-pulp-migrator-state", cm)
+	if steps := cm.Data["completedSteps"]; !strings.HasSuffix(steps, ",downscaleDBReplicas") {
+		t.Errorf("completed steps = %s, expected the steps before updateDBService", steps)
+	}
+
+	if err := opts.newPulp().migrate(c, opts); err != nil {
+		t.Fatalf("resumed migrate() = %v", err)
+	}
+	assertMigrated(t, c, opts)
+	assertSubscribed(t, c, opts)
+}
+
+// controllerDeployment returns a controller Deployment created by OLM for
+// the csv, with the labels of the operator-sdk manifests
+func controllerDeployment(csv string, labels map[string]string) *appsv1.Deployment {
+	labels["control-plane"] = "controller-manager"
+	labels["olm.owner"] = csv
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "pulp-operator-controller-manager",
+			Namespace: testNamespace,
+			Labels:    labels,
+			OwnerReferences: []metav1.OwnerReference{{
+				APIVersion: operatorsv1alpha1.SchemeGroupVersion.String(),
+				Kind:       operatorsv1alpha1.ClusterServiceVersionKind,
+				Name:       csv,
+			}},
+		},
+	}
+}
+
+// TestMigrateResumeWithoutSubscription verifies that a migration resumed
+// after the ansible operator Subscription was deleted does not mistake the
+// deployments created by OLM for an operator deployed without it
+func TestMigrateResumeWithoutSubscription(t *testing.T) {
+	tests := []struct {
+		name            string
+		failOn          string
+		newSubscription string
+		// created by OLM before the migration is resumed
+		deployment *appsv1.Deployment
+	}{
+		{
+			name:       "deleteCSV",
+			failOn:     "delete ClusterServiceVersion",
+			deployment: controllerDeployment(testCSV, map[string]string{}),
+		},
+		{
+			name:            "waitForOperator",
+			failOn:          "get ClusterServiceVersion",
+			newSubscription: "pulp-operator-golang",
+			deployment:      controllerDeployment("pulp-operator.v1.0.0-alpha.5", map[string]string{"app.kubernetes.io/component": "operator"}),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			objs := ansibleInstall()
+			if tt.newSubscription != "" {
+				for _, obj := range objs {
+					if obj.GetObjectKind().GroupVersionKind().Kind == "PackageManifest" {
+						obj.SetName(tt.newSubscription)
+					}
+				}
+			}
+			c := newFakeCluster(objs...)
+			c.failOn = tt.failOn
+			opts := testOptions(t)
+			opts.newSubscriptionName = tt.newSubscription
+			if opts.newSubscriptionName == "" {
+				opts.newSubscriptionName = opts.subscriptionName
+			}
+			opts.rollbackOnFailure = false
+			if err := opts.newPulp().migrate(c, opts); err == nil {
+				t.Fatal("migrate() succeeded, expected the injected failure")
+			}
+			assertNotFound(t, c, testNamespace, "pulp-operator", &operatorsv1alpha1.Subscription{})
+
+			if err := c.Create(context.TODO(), tt.deployment); err != nil {
+				t.Fatal(err)
+			}
+			if err := opts.newPulp().migrate(c, opts); err != nil {
+				t.Fatalf("resumed migrate() = %v", err)
+			}
+			assertMigrated(t, c, opts)
+			assertNotFound(t, c, testNamespace, testCSV, &operatorsv1alpha1.ClusterServiceVersion{})
+			get(t, c, testNamespace, tt.deployment.Name, &appsv1.Deployment{})
+		})
+	}
+}
+
+func TestMigrateLiveRoute(t *testing.T) {
+	objs := ansibleInstall()
+	cr := objs[0].(*unstructured.Unstructured)
+	cr.SetUID("example-pulp-uid")
+	owner := metav1.OwnerReference{APIVersion: "pulp.pulpproject.org/v1beta1", Kind: "Pulp", Name: "example-pulp", UID: "example-pulp-uid"}
+	objs = append(objs,
+		&routev1.Route{
+			ObjectMeta: metav1.ObjectMeta{Name: "example-pulp", Namespace: testNamespace, OwnerReferences: []metav1.OwnerReference{owner}},
+			Spec: routev1.RouteSpec{
+				Host: "pulp.example.com",
+				TLS:  &routev1.TLSConfig{Termination: routev1.TLSTerminationEdge},
+			},
+		},
+		// not created by the ansible operator
+		&routev1.Route{
+			ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: testNamespace},
+			Spec:       routev1.RouteSpec{Host: "other.example.com"},
+		},
+	)
+	c := newFakeCluster(objs...)
+	opts := testOptions(t)
+	if err := opts.newPulp().migrate(c, opts); err != nil {
+		t.Fatalf("migrate() = %v", err)
+	}
+	assertMigrated(t, c, opts)
+
+	pulpNew := &repomanagerv1alpha1.Pulp{}
+	get(t, c, testNamespace, "example-pulp", pulpNew)
+	if pulpNew.Spec.RouteHost != "pulp.example.com" {
+		t.Errorf("golang Pulp CR route_host = %q, expected the host of the live route", pulpNew.Spec.RouteHost)
+	}
+}
+
+func TestMigrateVerificationFailure(t *testing.T) {
+	c := newFakeCluster(ansibleInstall()...)
+	c.operatorDown = true
+	opts := testOptions(t)
+	opts.verifyTimeout = time.Nanosecond
+	if err := opts.newPulp().migrate(c, opts); !errors.Is(err, errVerificationFailed) {
+		t.Fatalf("migrate() = %v, expected %v", err, errVerificationFailed)
+	}
+
+	// everything was handed over to the golang operator, so it is not rolled back
+	get(t, c, testNamespace, "example-pulp", newUnstructured(opts.newApi, opts.newKind))
+	assertNotFound(t, c, testNamespace, testCSV, &operatorsv1alpha1.ClusterServiceVersion{})
+}
+
+// testIndexImage is the index image of the CatalogSource created by the migrator
+const testIndexImage = "quay.io/pulp/pulp-operator-index:v1.0.0-alpha.5"
+
+// withBackups returns the objects of ansibleInstall with a completed backup,
+// the pre-migration backup and a failed restore of the Pulp CR
+func withBackups() []client.Object {
+	completed := map[string]any{
+		"backupClaim":     "example-pulp-backup-claim",
+		"backupDirectory": "/backups/openshift-backup-2023-01-01",
+		"conditions":      []any{map[string]any{"type": "Successful", "status": "True"}},
+	}
+	return append(ansibleInstall(),
+		&unstructured.Unstructured{Object: map[string]any{
+			"apiVersion": "pulp.pulpproject.org/v1beta1",
+			"kind":       "PulpBackup",
+			"metadata":   map[string]any{"name": "example-pulp-backup", "namespace": testNamespace},
+			"spec":       map[string]any{"deployment_name": "example-pulp"},
+			"status":     completed,
+		}},
+		&unstructured.Unstructured{Object: map[string]any{
+			"apiVersion": "pulp.pulpproject.org/v1beta1",
+			"kind":       "PulpBackup",
+			"metadata": map[string]any{
+				"name":        "example-pulp-pre-migration-backup",
+				"namespace":   testNamespace,
+				"annotations": map[string]any{backupAnnotation: "example-pulp"},
+			},
+			"spec":   map[string]any{"deployment_name": "example-pulp"},
+			"status": completed,
+		}},
+		&unstructured.Unstructured{Object: map[string]any{
+			"apiVersion": "pulp.pulpproject.org/v1beta1",
+			"kind":       "PulpRestore",
+			"metadata":   map[string]any{"name": "example-pulp-restore", "namespace": testNamespace},
+			"spec":       map[string]any{"deployment_name": "example-pulp", "backup_name": "example-pulp-backup"},
+			"status":     map[string]any{"conditions": []any{map[string]any{"type": "Failure", "status": "True"}}},
+		}},
+	)
+}
+
+func TestMigrateBackups(t *testing.T) {
+	for _, convertRestores := range []bool{false, true} {
+		c := newFakeCluster(withBackups()...)
+		opts := testOptions(t)
+		opts.convertRestores = convertRestores
+		if err := opts.newPulp().migrate(c, opts); err != nil {
+			t.Fatalf("migrate() = %v", err)
+		}
+
+		get(t, c, testNamespace, "example-pulp-backup", newUnstructured(opts.newApi, "PulpBackup"))
+		assertNotFound(t, c, testNamespace, "example-pulp-pre-migration-backup", newUnstructured(opts.newApi, "PulpBackup"))
+		if convertRestores {
+			get(t, c, testNamespace, "example-pulp-restore", newUnstructured(opts.newApi, "PulpRestore"))
+		} else {
+			assertNotFound(t, c, testNamespace, "example-pulp-restore", newUnstructured(opts.newApi, "PulpRestore"))
+		}
+	}
+}
+
+// TestMigratePreMigrationBackup verifies that the backup is taken before the
+// migration, and taken again when the one of a previous run failed
+func TestMigratePreMigrationBackup(t *testing.T) {
+	failedCR := &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "pulp.pulpproject.org/v1beta1",
+		"kind":       "PulpBackup",
+		"metadata":   map[string]any{"name": "example-pulp-pre-migration-backup", "namespace": testNamespace},
+		"spec":       map[string]any{"deployment_name": "example-pulp"},
+		"status":     map[string]any{"conditions": []any{map[string]any{"type": "Failure", "status": "True"}}},
+	}}
+	failedJob := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{Name: "example-pulp-pre-migration-backup", Namespace: testNamespace},
+		Status:     batchv1.JobStatus{Failed: 1},
+	}
+	tests := []struct {
+		name     string
+		method   string
+		previous client.Object
+		backup   client.Object
+		location string
+	}{
+		{"cr", backupCR, nil, newUnstructured("pulp.pulpproject.org/v1beta1", "PulpBackup"),
+			"PulpBackup example-pulp-pre-migration-backup (PVC example-pulp-backup-claim, directory /backups/openshift-backup-2023-01-01)"},
+		{"cr retried", backupCR, failedCR, newUnstructured("pulp.pulpproject.org/v1beta1", "PulpBackup"),
+			"PulpBackup example-pulp-pre-migration-backup-2 (PVC example-pulp-backup-claim, directory /backups/openshift-backup-2023-01-01)"},
+		{"pg-dump", backupPGDump, nil, &batchv1.Job{},
+			"PVC example-pulp-pre-migration-backup, file /backup/example-pulp.dump"},
+		{"pg-dump retried", backupPGDump, failedJob, &batchv1.Job{},
+			"PVC example-pulp-pre-migration-backup, file /backup/example-pulp.dump"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			objs := ansibleInstall()
+			name := "example-pulp-pre-migration-backup"
+			if tt.previous != nil {
+				objs = append(objs, tt.previous)
+				name += "-2"
+			}
+			c := newFakeCluster(objs...)
+			opts := testOptions(t)
+			opts.backupMethod = tt.method
+			if err := opts.newPulp().migrate(c, opts); err != nil {
+				t.Fatalf("migrate() = %v", err)
+			}
+			assertMigrated(t, c, opts)
+
+			get(t, c, testNamespace, name, tt.backup)
+			if tt.method == backupCR {
+				if owner := tt.backup.GetAnnotations()[backupAnnotation]; owner != "example-pulp" {
+					t.Errorf("backup CR %s annotation = %q, expected example-pulp", backupAnnotation, owner)
+				}
+				// the golang operator would run it again
+				assertNotFound(t, c, testNamespace, name, newUnstructured(opts.newApi, "PulpBackup"))
+			}
+			cr := newUnstructured(opts.api, "Pulp")
+			get(t, c, testNamespace, "example-pulp", cr)
+			if location := cr.GetAnnotations()[backupAnnotation]; location != tt.location {
+				t.Errorf("ansible Pulp CR %s annotation = %q, expected %q", backupAnnotation, location, tt.location)
+			}
+		})
+	}
+}
+
+// TestHandleInstallPlan verifies that with Manual approval only the
+// InstallPlan of the starting CSV is approved, and only when requested
+func TestHandleInstallPlan(t *testing.T) {
+	tests := []struct {
+		name     string
+		approve  bool
+		csvs     []string
+		approved bool
+	}{
+		{"starting CSV", true, []string{"pulp-operator.v1.0.0-alpha.5"}, true},
+		{"other CSV", true, []string{"pulp-operator.v1.0.0-beta.1"}, false},
+		{"starting CSV and an upgrade", true, []string{"pulp-operator.v1.0.0-alpha.5", "pulp-operator.v1.0.0-beta.1"}, false},
+		{"approval not requested", false, []string{"pulp-operator.v1.0.0-alpha.5"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newFakeCluster(&operatorsv1alpha1.InstallPlan{
+				ObjectMeta: metav1.ObjectMeta{Name: "install-abcde", Namespace: testNamespace},
+				Spec: operatorsv1alpha1.InstallPlanSpec{
+					ClusterServiceVersionNames: tt.csvs,
+					Approval:                   operatorsv1alpha1.ApprovalManual,
+				},
+			})
+			opts := testOptions(t)
+			opts.installPlanApproval = string(operatorsv1alpha1.ApprovalManual)
+			opts.approveInstallPlan = tt.approve
+			approved, err := opts.newPulp().handleInstallPlan(c, "install-abcde")
+			if err != nil {
+				t.Fatalf("handleInstallPlan() = %v", err)
+			}
+			if approved != tt.approved {
+				t.Errorf("handleInstallPlan() = %v, expected %v", approved, tt.approved)
+			}
+			installPlan := &operatorsv1alpha1.InstallPlan{}
+			get(t, c, testNamespace, "install-abcde", installPlan)
+			if installPlan.Spec.Approved != tt.approved {
+				t.Errorf("installplan approved = %v, expected %v", installPlan.Spec.Approved, tt.approved)
+			}
+		})
+	}
+}
+
+func TestNeedsWeb(t *testing.T) {
+	c := newFakeCluster(
+		&networkingv1.IngressClass{ObjectMeta: metav1.ObjectMeta{Name: "nginx"}, Spec: networkingv1.IngressClassSpec{Controller: "k8s.io/ingress-nginx"}},
+		&networkingv1.IngressClass{ObjectMeta: metav1.ObjectMeta{Name: "traefik"}, Spec: networkingv1.IngressClassSpec{Controller: "traefik.io/ingress-controller"}},
+	)
+	tests := []struct {
+		ingressType  string
+		ingressClass string
+		expected     bool
+	}{
+		{"route", "", false},
+		{"ingress", "nginx", false},
+		{"ingress", "traefik", true},
+		{"ingress", "", true},
+		{"nodeport", "", true},
+	}
+	for _, tt := range tests {
+		spec := repomanagerv1alpha1.PulpSpec{IngressType: tt.ingressType, IngressClassName: tt.ingressClass}
+		if needed := (pulp{}).needsWeb(c, spec); needed != tt.expected {
+			t.Errorf("needsWeb(%s, %q) = %t, expected %t", tt.ingressType, tt.ingressClass, needed, tt.expected)
+		}
+	}
+}
+
+// indexImageOptions returns the options of a migration that creates the
+// pulp-index CatalogSource
+func indexImageOptions(t *testing.T) *options {
+	opts := testOptions(t)
+	opts.source = "pulp-index"
+	opts.indexImage = testIndexImage
+	return opts
+}
+
+// indexImageInstall returns the objects of ansibleInstall with the golang
+// operator package served by the pulp-index CatalogSource once it is created
+func indexImageInstall() []client.Object {
+	objs := ansibleInstall()
+	for _, obj := range objs {
+		if obj.GetObjectKind().GroupVersionKind().Kind == "PackageManifest" {
+			obj.SetLabels(map[string]string{"catalog": "pulp-index", "catalog-namespace": "openshift-marketplace"})
+		}
+	}
+	return objs
+}
+
+func TestMigrateIndexImage(t *testing.T) {
+	opts := indexImageOptions(t)
+	c := newFakeCluster(indexImageInstall()...)
+	if err := opts.newPulp().migrate(c, opts); err != nil {
+		t.Fatalf("migrate() = %v", err)
+	}
+	assertMigrated(t, c, opts)
+	assertSubscribed(t, c, opts)
+
+	catalog := &operatorsv1alpha1.CatalogSource{}
+	get(t, c, "openshift-marketplace", "pulp-index", catalog)
+	if catalog.Spec.Image != testIndexImage || catalog.Spec.SourceType != operatorsv1alpha1.SourceTypeGrpc {
+		t.Errorf("catalogsource spec = %+v, expected a grpc catalog of %s", catalog.Spec, testIndexImage)
+	}
+	sub := &operatorsv1alpha1.Subscription{}
+	get(t, c, testNamespace, "pulp-operator", sub)
+	if sub.Spec.CatalogSource != "pulp-index" {
+		t.Errorf("subscription catalogSource = %q, expected pulp-index", sub.Spec.CatalogSource)
+	}
+}
+
+func TestMigrateIndexImageRollback(t *testing.T) {
+	opts := indexImageOptions(t)
+	c := newFakeCluster(indexImageInstall()...)
+	c.failOn = "create Pulp"
+	if err := opts.newPulp().migrate(c, opts); err == nil {
+		t.Fatal("migrate() succeeded, expected the injected failure")
+	}
+	assertUnchanged(t, c, opts)
+	assertNotFound(t, c, "openshift-marketplace", "pulp-index", &operatorsv1alpha1.CatalogSource{})
+}
+
+func TestMigrateIndexImageReused(t *testing.T) {
+	opts := indexImageOptions(t)
+	catalog := &operatorsv1alpha1.CatalogSource{
+		ObjectMeta: metav1.ObjectMeta{Name: "pulp-index", Namespace: "openshift-marketplace"},
+		Spec:       operatorsv1alpha1.CatalogSourceSpec{SourceType: operatorsv1alpha1.SourceTypeGrpc, Image: testIndexImage},
+		Status: operatorsv1alpha1.CatalogSourceStatus{
+			GRPCConnectionState: &operatorsv1alpha1.GRPCConnectionState{LastObservedState: "READY"},
+		},
+	}
+	c := newFakeCluster(append(indexImageInstall(), catalog)...)
+	c.failOn = "create Pulp"
+	if err := opts.newPulp().migrate(c, opts); err == nil {
+		t.Fatal("migrate() succeeded, expected the injected failure")
+	}
+	// it was not created by the migrator, so it is kept by rollback
+	get(t, c, "openshift-marketplace", "pulp-index", &operatorsv1alpha1.CatalogSource{})
+}
+
+func TestMigrateIndexImageConflict(t *testing.T) {
+	opts := indexImageOptions(t)
+	opts.source = "community-operators"
+	c := newFakeCluster(ansibleInstall()...)
+	if err := opts.newPulp().migrate(c, opts); err == nil {
+		t.Fatal("migrate() succeeded, expected the pre-flight checks to fail")
+	}
+	assertUnchanged(t, c, opts)
+}
+
+// withOperatorGroup returns the objects of ansibleInstall with an
+// OperatorGroup selecting all namespaces, or without any if allNamespaces is false
+func withOperatorGroup(allNamespaces bool) []client.Object {
+	objs := []client.Object{}
+	for _, obj := range ansibleInstall() {
+		og, ok := obj.(*operatorsv1.OperatorGroup)
+		if !ok {
+			objs = append(objs, obj)
+		} else if allNamespaces {
+			og.Spec.TargetNamespaces = nil
+			objs = append(objs, og)
+		}
+	}
+	return objs
+}
+
+func TestMigrateOperatorGroupUnsupported(t *testing.T) {
+	c := newFakeCluster(withOperatorGroup(true)...)
+	opts := testOptions(t)
+	if err := opts.newPulp().migrate(c, opts); err == nil {
+		t.Fatal("migrate() succeeded, expected the pre-flight checks to fail")
+	}
+	assertUnchanged(t, c, opts)
+}
+
+func TestMigrateOperatorGroupAdjusted(t *testing.T) {
+	c := newFakeCluster(withOperatorGroup(true)...)
+	opts := testOptions(t)
+	opts.adjustOperatorGroup = true
+	if err := opts.newPulp().migrate(c, opts); err != nil {
+		t.Fatalf("migrate() = %v", err)
+	}
+	assertMigrated(t, c, opts)
+
+	og := &operatorsv1.OperatorGroup{}
+	get(t, c, testNamespace, "pulp-operator-group", og)
+	if !reflect.DeepEqual(og.Spec.TargetNamespaces, []string{testNamespace}) {
+		t.Errorf("operatorgroup targetNamespaces = %v, expected [%s]", og.Spec.TargetNamespaces, testNamespace)
+	}
+}
+
+func TestMigrateOperatorGroupRollback(t *testing.T) {
+	c := newFakeCluster(withOperatorGroup(true)...)
+	c.failOn = "create Subscription"
+	opts := testOptions(t)
+	opts.adjustOperatorGroup = true
+	if err := opts.newPulp().migrate(c, opts); err == nil {
+		t.Fatal("migrate() succeeded, expected the injected failure")
+	}
+	assertUnchanged(t, c, opts)
+
+	og := &operatorsv1.OperatorGroup{}
+	get(t, c, testNamespace, "pulp-operator-group", og)
+	if len(og.Spec.TargetNamespaces) != 0 {
+		t.Errorf("operatorgroup targetNamespaces = %v, expected all namespaces", og.Spec.TargetNamespaces)
+	}
+}
+
+func TestMigrateOperatorGroupCreated(t *testing.T) {
+	c := newFakeCluster(withOperatorGroup(false)...)
+	opts := testOptions(t)
+	opts.adjustOperatorGroup = true
+	if err := opts.newPulp().migrate(c, opts); err != nil {
+		t.Fatalf("migrate() = %v", err)
+	}
+	assertMigrated(t, c, opts)
+
+	og := &operatorsv1.OperatorGroup{}
+	get(t, c, testNamespace, "pulp-operator", og)
+	if !reflect.DeepEqual(og.Spec.TargetNamespaces, []string{testNamespace}) {
+		t.Errorf("operatorgroup targetNamespaces = %v, expected [%s]", og.Spec.TargetNamespaces, testNamespace)
+	}
+}
+
+// ansibleInstallWithoutOLM returns the objects of a Pulp CR deployed by an
+// ansible operator installed with make deploy
+func ansibleInstallWithoutOLM() []client.Object {
+	objs := []client.Object{
+		&appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "pulp-operator-controller-manager", Namespace: testNamespace, Labels: controllerLabels},
+			Spec: appsv1.DeploymentSpec{
+				Selector: &metav1.LabelSelector{MatchLabels: controllerLabels},
+				Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{ServiceAccountName: "pulp-operator-sa"}},
+			},
+		},
+		&corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "pulp-operator-sa", Namespace: testNamespace}},
+		&rbacv1.Role{ObjectMeta: metav1.ObjectMeta{Name: "pulp-operator-leader-election-role", Namespace: testNamespace}},
+		&rbacv1.RoleBinding{
+			ObjectMeta: metav1.ObjectMeta{Name: "pulp-operator-leader-election-rolebinding", Namespace: testNamespace},
+			Subjects:   []rbacv1.Subject{{Kind: rbacv1.ServiceAccountKind, Name: "pulp-operator-sa", Namespace: testNamespace}},
+			RoleRef:    rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "Role", Name: "pulp-operator-leader-election-role"},
+		},
+		// bound to other subjects too, so it is kept
+		&rbacv1.RoleBinding{
+			ObjectMeta: metav1.ObjectMeta{Name: "shared-rolebinding", Namespace: testNamespace},
+			Subjects: []rbacv1.Subject{
+				{Kind: rbacv1.ServiceAccountKind, Name: "pulp-operator-sa", Namespace: testNamespace},
+				{Kind: rbacv1.ServiceAccountKind, Name: "default", Namespace: testNamespace},
+			},
+			RoleRef: rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "ClusterRole", Name: "view"},
+		},
+	}
+	for _, obj := range ansibleInstall() {
+		switch obj.(type) {
+		case *operatorsv1alpha1.Subscription, *operatorsv1alpha1.ClusterServiceVersion:
+		default:
+			objs = append(objs, obj)
+		}
+	}
+	return objs
+}
+
+// withoutOLMObjects removes the objects of the OLM APIs
+func withoutOLMObjects(objs []client.Object) []client.Object {
+	filtered := []client.Object{}
+	for _, obj := range objs {
+		gvk, err := apiutil.GVKForObject(obj, scheme)
+		if err != nil || !strings.HasSuffix(gvk.Group, "operators.coreos.com") {
+			filtered = append(filtered, obj)
+		}
+	}
+	return filtered
+}
+
+func TestMigrateWithoutOLM(t *testing.T) {
+	c := newFakeCluster(ansibleInstallWithoutOLM()...)
+	opts := testOptions(t)
+	if err := opts.newPulp().migrate(c, opts); err != nil {
+		t.Fatalf("migrate() = %v", err)
+	}
+	assertMigrated(t, c, opts)
+	assertSubscribed(t, c, opts)
+
+	assertNotFound(t, c, testNamespace, "pulp-operator-controller-manager", &appsv1.Deployment{})
+	assertNotFound(t, c, testNamespace, "pulp-operator-sa", &corev1.ServiceAccount{})
+	assertNotFound(t, c, testNamespace, "pulp-operator-leader-election-role", &rbacv1.Role{})
+	assertNotFound(t, c, testNamespace, "pulp-operator-leader-election-rolebinding", &rbacv1.RoleBinding{})
+	get(t, c, testNamespace, "shared-rolebinding", &rbacv1.RoleBinding{})
+}
+
+func TestMigrateWithoutOLMRollback(t *testing.T) {
+	c := newFakeCluster(ansibleInstallWithoutOLM()...)
+	c.failOn = "create Pulp"
+	opts := testOptions(t)
+	if err := opts.newPulp().migrate(c, opts); err == nil {
+		t.Fatal("migrate() succeeded, expected the injected failure")
+	}
+
+	deployment := &appsv1.Deployment{}
+	get(t, c, testNamespace, "pulp-operator-controller-manager", deployment)
+	if deployment.Spec.Template.Spec.ServiceAccountName != "pulp-operator-sa" {
+		t.Errorf("operator deployment serviceAccountName = %q, expected pulp-operator-sa", deployment.Spec.Template.Spec.ServiceAccountName)
+	}
+	get(t, c, testNamespace, "pulp-operator-sa", &corev1.ServiceAccount{})
+	get(t, c, testNamespace, "pulp-operator-leader-election-role", &rbacv1.Role{})
+	get(t, c, testNamespace, "pulp-operator-leader-election-rolebinding", &rbacv1.RoleBinding{})
+	for name := range testDeployments {
+		get(t, c, testNamespace, name, &appsv1.Deployment{})
+	}
+	assertNotFound(t, c, testNamespace, "example-pulp", newUnstructured(opts.newApi, opts.newKind))
+}
+
+func TestMigrateWithoutOLMInstall(t *testing.T) {
+	c := newFakeClusterWithoutOLM(withoutOLMObjects(ansibleInstallWithoutOLM())...)
+	opts := testOptions(t)
+	if err := opts.newPulp().migrate(c, opts); err != nil {
+		t.Fatalf("migrate() = %v", err)
+	}
+	assertMigrated(t, c, opts)
+
+	// the ansible operator was replaced by the embedded golang operator manifests
+	assertNotFound(t, c, testNamespace, "pulp-operator-sa", &corev1.ServiceAccount{})
+	deployment := &appsv1.Deployment{}
+	get(t, c, testNamespace, "pulp-operator-controller-manager", deployment)
+	if sa := deployment.Spec.Template.Spec.ServiceAccountName; sa != "pulp-operator-controller-manager" {
+		t.Errorf("operator deployment serviceAccountName = %q, expected the golang operator one", sa)
+	}
+	get(t, c, "", "pulps.repo-manager.pulpproject.org", newUnstructured("apiextensions.k8s.io/v1", "CustomResourceDefinition"))
+	binding := &rbacv1.ClusterRoleBinding{}
+	get(t, c, "", "pulp-operator-manager-rolebinding", binding)
+	if len(binding.Subjects) != 1 || binding.Subjects[0].Namespace != testNamespace {
+		t.Errorf("ClusterRoleBinding subjects = %v, expected the ServiceAccount in %s namespace", binding.Subjects, testNamespace)
+	}
+}
+
+func TestMigrateWithoutOLMInstallRollback(t *testing.T) {
+	c := newFakeClusterWithoutOLM(withoutOLMObjects(ansibleInstallWithoutOLM())...)
+	c.failOn = "create Pulp"
+	opts := testOptions(t)
+	if err := opts.newPulp().migrate(c, opts); err == nil {
+		t.Fatal("migrate() succeeded, expected the injected failure")
+	}
+
+	assertNotFound(t, c, "", "pulps.repo-manager.pulpproject.org", newUnstructured("apiextensions.k8s.io/v1", "CustomResourceDefinition"))
+	assertNotFound(t, c, "", "pulp-operator-manager-rolebinding", &rbacv1.ClusterRoleBinding{})
+	assertNotFound(t, c, testNamespace, "pulp-operator-controller-manager", &corev1.ServiceAccount{})
+	deployment := &appsv1.Deployment{}
+	get(t, c, testNamespace, "pulp-operator-controller-manager", deployment)
+	if sa := deployment.Spec.Template.Spec.ServiceAccountName; sa != "pulp-operator-sa" {
+		t.Errorf("operator deployment serviceAccountName = %q, expected the ansible operator one", sa)
+	}
+}
@@ -0,0 +1,312 @@
+package main
+
+import (
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	operatorsv1alpha1 "github.com/operator-framework/api/pkg/operators/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+)
+
+// golangOperatorManifests are the CRDs, RBAC and Deployment of the golang
+// operator applied when OLM is not installed and no other manifests are provided
+//
+//go:embed manifests/golang-operator
+var golangOperatorManifests embed.FS
+
+// manifestsOrder is the order in which the kinds of the manifests are
+// created, the other kinds are created at the end
+var manifestsOrder = []string{
+	"CustomResourceDefinition",
+	"ServiceAccount",
+	"ClusterRole",
+	"Role",
+	"ClusterRoleBinding",
+	"RoleBinding",
+	"ConfigMap",
+	"Secret",
+	"Service",
+	"Deployment",
+}
+
+// olmInstalled returns true if the API server serves the OLM Subscriptions
+func olmInstalled(c cluster) (bool, error) {
+	gvk := operatorsv1alpha1.SchemeGroupVersion.WithKind("Subscription")
+	_, err := c.RESTMapper().RESTMapping(gvk.GroupKind(), gvk.Version)
+	if meta.IsNoMatchError(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// loadOperatorManifests returns the objects of the golang operator manifests,
+// from operatorManifests (a file or a directory of yaml/json files) or the
+// embedded ones, in the order they should be created
+func (pulp pulp) loadOperatorManifests() ([]*unstructured.Unstructured, error) {
+	var fsys fs.FS = golangOperatorManifests
+	root := "manifests/golang-operator"
+	if pulp.operatorManifests != "" {
+		info, err := os.Stat(pulp.operatorManifests)
+		if err != nil {
+			return nil, err
+		}
+		fsys, root = os.DirFS(pulp.operatorManifests), "."
+		if !info.IsDir() {
+			fsys, root = os.DirFS(filepath.Dir(pulp.operatorManifests)), filepath.Base(pulp.operatorManifests)
+		}
+	}
+
+	files := []string{}
+	err := fs.WalkDir(fsys, root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if ext := filepath.Ext(path); !entry.IsDir() && (ext == ".yaml" || ext == ".yml" || ext == ".json") {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	objs := []*unstructured.Unstructured{}
+	for _, file := range files {
+		f, err := fsys.Open(file)
+		if err != nil {
+			return nil, err
+		}
+		decoder := utilyaml.NewYAMLOrJSONDecoder(f, 4096)
+		for {
+			raw := json.RawMessage{}
+			if err := decoder.Decode(&raw); errors.Is(err, io.EOF) {
+				break
+			} else if err != nil {
+				f.Close()
+				return nil, fmt.Errorf("failed to read %s: %w", file, err)
+			}
+			// empty documents
+			if len(raw) == 0 || string(raw) == "null" {
+				continue
+			}
+			obj := &unstructured.Unstructured{}
+			if err := obj.UnmarshalJSON(raw); err != nil {
+				f.Close()
+				return nil, fmt.Errorf("failed to read %s: %w", file, err)
+			}
+			objs = append(objs, obj)
+		}
+		f.Close()
+	}
+	if len(objs) == 0 {
+		return nil, fmt.Errorf("no manifests found in %s", root)
+	}
+
+	order := func(obj *unstructured.Unstructured) int {
+		for i, kind := range manifestsOrder {
+			if obj.GetKind() == kind {
+				return i
+			}
+		}
+		return len(manifestsOrder)
+	}
+	sort.SliceStable(objs, func(i, j int) bool { return order(objs[i]) < order(objs[j]) })
+	return objs, nil
+}
+
+// operatorDeployments returns the names of the Deployments in the golang
+// operator manifests
+func operatorDeployments(objs []*unstructured.Unstructured) []string {
+	deployments := []string{}
+	for _, obj := range objs {
+		if obj.GetKind() == "Deployment" {
+			deployments = append(deployments, obj.GetName())
+		}
+	}
+	return deployments
+}
+
+// setManifestNamespace moves a namespaced object of the manifests, and the
+// ServiceAccounts bound by it, to the namespace of the golang Pulp CR
+func (pulp pulp) setManifestNamespace(c cluster, obj *unstructured.Unstructured) error {
+	gvk := obj.GroupVersionKind()
+	mapping, err := c.RESTMapper().RESTMapping(gvk.GroupKind(), gvk.Version)
+	// the kinds of the CRDs created by the manifests are not known yet
+	if meta.IsNoMatchError(err) {
+		obj.SetNamespace(pulp.newSubscriptionNamespace)
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+		obj.SetNamespace(pulp.newSubscriptionNamespace)
+	}
+
+	subjects, found, err := unstructured.NestedSlice(obj.Object, "subjects")
+	if err != nil || !found {
+		return err
+	}
+	for _, subject := range subjects {
+		if subject, ok := subject.(map[string]any); ok && subject["kind"] == "ServiceAccount" {
+			subject["namespace"] = pulp.newSubscriptionNamespace
+		}
+	}
+	return unstructured.SetNestedSlice(obj.Object, subjects, "subjects")
+}
+
+// checkOperatorManifests verifies that the golang operator manifests can be
+// read, that their kinds are served by the API server (or defined by their
+// CRDs) and that they deploy the operator
+func (pulp pulp) checkOperatorManifests(c cluster) error {
+	objs, err := pulp.loadOperatorManifests()
+	if err != nil {
+		return err
+	}
+	defined := map[string]bool{}
+	for _, obj := range objs {
+		if obj.GetKind() == "CustomResourceDefinition" {
+			group, _, _ := unstructured.NestedString(obj.Object, "spec", "group")
+			kind, _, _ := unstructured.NestedString(obj.Object, "spec", "names", "kind")
+			defined[kind+"."+group] = true
+		}
+	}
+	for _, obj := range objs {
+		gvk := obj.GroupVersionKind()
+		_, err := c.RESTMapper().RESTMapping(gvk.GroupKind(), gvk.Version)
+		if meta.IsNoMatchError(err) && !defined[gvk.GroupKind().String()] {
+			return fmt.Errorf("%s %s is not served by the API server", gvk.Kind, obj.GetName())
+		} else if err != nil && !meta.IsNoMatchError(err) {
+			return err
+		}
+	}
+	if len(operatorDeployments(objs)) == 0 {
+		return fmt.Errorf("no Deployment found in the manifests")
+	}
+	return nil
+}
+
+// manifestsPermissions returns the requests made to install the golang
+// operator from its manifests
+func (pulp pulp) manifestsPermissions(c cluster) []permission {
+	permissions := []permission{{"get", "apps", "deployments", pulp.newSubscriptionNamespace}}
+	// the errors are reported by checkOperatorManifests
+	objs, _ := pulp.loadOperatorManifests()
+	for _, obj := range objs {
+		gvk := obj.GroupVersionKind()
+		mapping, err := c.RESTMapper().RESTMapping(gvk.GroupKind(), gvk.Version)
+		if err != nil {
+			continue
+		}
+		namespace := ""
+		if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+			namespace = pulp.newSubscriptionNamespace
+		}
+		p := permission{"create", gvk.Group, mapping.Resource.Resource, namespace}
+		found := false
+		for _, added := range permissions {
+			found = found || added == p
+		}
+		if !found {
+			permissions = append(permissions, p)
+		}
+	}
+	return permissions
+}
+
+// applyOperatorManifests installs the golang operator from its manifests in
+// the namespace of the golang Pulp CR. The objects that already exist (like
+// the CRDs of a golang operator installed in another namespace) are kept.
+func (pulp pulp) applyOperatorManifests(c cluster) error {
+	fmt.Println("Installing the golang operator from its manifests ...")
+	objs, err := pulp.loadOperatorManifests()
+	if err != nil {
+		fmt.Println("❌ Failed to load the golang operator manifests:", err)
+		return fmt.Errorf("failed to load the golang operator manifests: %w", err)
+	}
+
+	for _, obj := range objs {
+		if err := pulp.setManifestNamespace(c, obj); err != nil {
+			fmt.Println("❌ Failed to find the "+obj.GetKind()+" resource:", err)
+			return fmt.Errorf("failed to find the %s resource: %w", obj.GetKind(), err)
+		}
+		fmt.Println("Creating", describe(c, obj), "...")
+		err := pulp.create(c, obj)
+		if apierrors.IsAlreadyExists(err) {
+			fmt.Println("⏭️ ", describe(c, obj), "already exists")
+			continue
+		} else if err != nil {
+			fmt.Println("❌ Failed to create "+describe(c, obj)+":", err)
+			return fmt.Errorf("failed to create %s: %w", describe(c, obj), err)
+		}
+		pulp.original.OperatorObjects = append(pulp.original.OperatorObjects, corev1.ObjectReference{
+			APIVersion: obj.GetAPIVersion(),
+			Kind:       obj.GetKind(),
+			Namespace:  obj.GetNamespace(),
+			Name:       obj.GetName(),
+		})
+	}
+	return nil
+}
+
+// waitForOperatorDeployment waits for the Deployments of the golang operator
+// manifests to be ready
+func (pulp pulp) waitForOperatorDeployment(c cluster) error {
+	// nothing was installed in dry-run mode
+	if pulp.dryRun {
+		fmt.Println("📝 [dry-run] Waiting for the golang operator deployment to be ready")
+		return nil
+	}
+	objs, err := pulp.loadOperatorManifests()
+	if err != nil {
+		fmt.Println("❌ Failed to load the golang operator manifests:", err)
+		return fmt.Errorf("failed to load the golang operator manifests: %w", err)
+	}
+
+	deployments := operatorDeployments(objs)
+	fmt.Println("Waiting for the golang operator deployment", strings.Join(deployments, ", "), "to be ready ...")
+	var notReady error
+	err = waitFor(pulp.operatorTimeout, func() (bool, error) {
+		for _, name := range deployments {
+			if err := pulp.checkDeploymentReady(c, name); err != nil {
+				notReady = fmt.Errorf("deployment %s: %w", name, err)
+				return false, nil
+			}
+		}
+		return true, nil
+	})
+	if err != nil {
+		err = fmt.Errorf("%w, %v", err, notReady)
+		fmt.Println("❌ The golang operator was not installed:", err)
+		return err
+	}
+	fmt.Println("✅ Golang operator installed")
+	return nil
+}
+
+// deleteOperatorManifests removes the objects created by applyOperatorManifests
+func (pulp pulp) deleteOperatorManifests(c cluster) error {
+	objects := pulp.original.OperatorObjects
+	for i := len(objects) - 1; i >= 0; i-- {
+		obj := newUnstructured(objects[i].APIVersion, objects[i].Kind)
+		obj.SetNamespace(objects[i].Namespace)
+		obj.SetName(objects[i].Name)
+		if err := pulp.delete(c, obj); err != nil && !isMissing(err) {
+			return fmt.Errorf("failed to delete %s: %w", describe(c, obj), err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoadOperatorManifests(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"operator.yaml": `---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: pulp-operator-controller-manager
+spec:
+  replicas: 1
+---
+apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: pulp-operator-controller-manager
+`,
+		"crds/pulps.yaml": `apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: pulps.repo-manager.pulpproject.org
+`,
+		"README.md": "not a manifest",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		path     string
+		expected []string
+	}{
+		{"directory", dir, []string{"CustomResourceDefinition", "ServiceAccount", "Deployment"}},
+		{"file", filepath.Join(dir, "operator.yaml"), []string{"ServiceAccount", "Deployment"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			objs, err := pulp{operatorManifests: tt.path}.loadOperatorManifests()
+			if err != nil {
+				t.Fatal(err)
+			}
+			kinds := []string{}
+			for _, obj := range objs {
+				kinds = append(kinds, obj.GetKind())
+			}
+			if !reflect.DeepEqual(kinds, tt.expected) {
+				t.Errorf("loadOperatorManifests() kinds = %v, expected %v", kinds, tt.expected)
+			}
+			// integers are kept as such
+			if replicas := objs[len(objs)-1].Object["spec"].(map[string]any)["replicas"]; replicas != int64(1) {
+				t.Errorf("replicas = %#v, expected int64(1)", replicas)
+			}
+		})
+	}
+
+	// the embedded manifests
+	objs, err := pulp{}.loadOperatorManifests()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deployments := operatorDeployments(objs); !reflect.DeepEqual(deployments, []string{"pulp-operator-controller-manager"}) {
+		t.Errorf("embedded operator deployments = %v", deployments)
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"migrator/conversion"
+
+	"sigs.k8s.io/yaml"
+)
+
+// offlineOptions holds the flags of the offline conversion
+type offlineOptions struct {
+	file                string
+	output              string
+	newNamespace        string
+	dbPVC               string
+	redisPVC            string
+	ingressDomain       string
+	externalDBSecret    string
+	externalCacheSecret string
+	dbUser              string
+}
+
+// addOfflineFlags adds the flags of the offline conversion to the convert command
+func addOfflineFlags(flags *flag.FlagSet) *offlineOptions {
+	offline := &offlineOptions{}
+	flags.StringVar(&offline.file, "f", "", "convert the ansible Pulp CR manifest from this file without contacting the cluster (\"-\" reads from stdin)")
+	flags.StringVar(&offline.output, "o", "yaml", "output format of the golang Pulp CR in the offline conversion (yaml or json)")
+	flags.StringVar(&offline.newNamespace, "new-namespace", "", "namespace of the golang Pulp CR in the offline conversion (defaults to the ansible CR namespace)")
+	flags.StringVar(&offline.dbPVC, "db-pvc", "", "name of the PVC used by the current database pods in the offline conversion")
+	flags.StringVar(&offline.redisPVC, "redis-pvc", "", "name of the PVC used by the current redis pod in the offline conversion")
+	flags.StringVar(&offline.ingressDomain, "ingress-domain", "", "cluster default ingress domain in the offline conversion, used to build the route host when route_host is not defined")
+	flags.StringVar(&offline.externalDBSecret, "external-db-secret", "", "name of the secret with the external database credentials in the golang operator format in the offline conversion")
+	flags.StringVar(&offline.externalCacheSecret, "external-cache-secret", "", "name of the secret with the external Redis credentials in the golang operator format in the offline conversion")
+	flags.StringVar(&offline.dbUser, "db-user", "", "user of the current database in the offline conversion, used to check the database pods when it is not the default one")
+	return offline
+}
+
+// runOfflineConversion reads an ansible Pulp (or Galaxy) CR manifest from a file (or stdin)
+// and writes the golang Pulp CR to stdout without contacting the cluster.
+// The values that convert would look up in the cluster (database and redis PVCs and
+// default ingress domain) are provided through flags.
+func runOfflineConversion(offline *offlineOptions, opts *options) error {
+	if offline.output != "yaml" && offline.output != "json" {
+		return fmt.Errorf("invalid output format %q, must be one of yaml or json", offline.output)
+	}
+	reportFormat := strings.ToLower(opts.reportFormat)
+	if reportFormat != "text" && reportFormat != "json" {
+		return fmt.Errorf("invalid report format %q, must be one of text or json", opts.reportFormat)
+	}
+
+	var in io.Reader = os.Stdin
+	if offline.file != "-" {
+		f, err := os.Open(offline.file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+	manifest, err := io.ReadAll(in)
+	if err != nil {
+		return err
+	}
+
+	ansiblePulp := pulp{}
+	data, err := yaml.YAMLToJSON(manifest)
+	if err != nil {
+		return fmt.Errorf("failed to parse ansible Pulp CR: %w", err)
+	}
+
+	// fields with a different type than the one expected by AnsibleSpec are
+	// skipped (like convert does), but we let the user know about them
+	typeErr := &json.UnmarshalTypeError{}
+	if err := json.Unmarshal(data, &ansiblePulp); errors.As(err, &typeErr) {
+		fmt.Fprintln(os.Stderr, "⚠️  Ignoring field with unexpected type:", err)
+	} else if err != nil {
+		return fmt.Errorf("failed to parse ansible Pulp CR: %w", err)
+	}
+
+	convertSpec := conversion.Convert
+	switch {
+	case ansiblePulp.Kind == "Pulp" && strings.HasPrefix(ansiblePulp.ApiVersion, "pulp.pulpproject.org/"):
+	case ansiblePulp.Kind == "Galaxy" && strings.HasPrefix(ansiblePulp.ApiVersion, "galaxy.ansible.com/"):
+		convertSpec = conversion.ConvertGalaxy
+	default:
+		return fmt.Errorf("expected a pulp.pulpproject.org Pulp CR or a galaxy.ansible.com Galaxy CR, got %s %s", ansiblePulp.ApiVersion, ansiblePulp.Kind)
+	}
+
+	ansiblePulp.oldResourceName = ansiblePulp.Metadata.Name
+	ansiblePulp.oldSubscriptionNamespace = ansiblePulp.Metadata.Namespace
+	ansiblePulp.newSubscriptionNamespace = ansiblePulp.Metadata.Namespace
+	if offline.newNamespace != "" {
+		ansiblePulp.newSubscriptionNamespace = offline.newNamespace
+	}
+	ansiblePulp.newResourceName = ansiblePulp.Metadata.Name
+	if opts.newResourceName != "" {
+		ansiblePulp.newResourceName = opts.newResourceName
+	}
+	ansiblePulp.newApi = opts.newApi
+	ansiblePulp.newKind = opts.newKind
+	ansiblePulp.oldDBPVC = offline.dbPVC
+	ansiblePulp.externalDBSecret = offline.externalDBSecret
+	ansiblePulp.oldRedisPVC = offline.redisPVC
+	ansiblePulp.externalCacheSecret = offline.externalCacheSecret
+	ansiblePulp.dbUser = offline.dbUser
+
+	pulpNew, warnings := ansiblePulp.toGolang(convertSpec, offline.ingressDomain)
+	for _, warning := range warnings {
+		fmt.Fprintln(os.Stderr, "⚠️ ", warning)
+	}
+	report, err := formatReport(conversion.NewReport(ansiblePulp.Spec, pulpNew.Spec, warnings), reportFormat)
+	if err != nil {
+		return fmt.Errorf("failed to serialize the conversion report: %w", err)
+	}
+	fmt.Fprintln(os.Stderr, report)
+
+	var out []byte
+	if offline.output == "json" {
+		out, err = json.MarshalIndent(pulpNew, "", "  ")
+	} else {
+		out, err = yaml.Marshal(pulpNew)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to serialize new Pulp CR: %w", err)
+	}
+	fmt.Println(strings.TrimSuffix(string(out), "\n"))
+	return nil
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	operatorsv1alpha1 "github.com/operator-framework/api/pkg/operators/v1alpha1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// waitForOperator watches the golang operator Subscription until OLM installs
+// its CSV. With Manual approval, the InstallPlan of the starting CSV is approved
+// if requested, otherwise it waits for somebody to approve it.
+func (pulp pulp) waitForOperator(c cluster) error {
+	// nothing was installed in dry-run mode
+	if pulp.dryRun {
+		fmt.Println("📝 [dry-run] Waiting for", pulp.newSubscriptionName, "subscription to install the golang operator")
+		return nil
+	}
+
+	fmt.Println("Waiting for", pulp.newSubscriptionName, "subscription to install the golang operator ...")
+	notified := ""
+	err := waitFor(pulp.operatorTimeout, func() (bool, error) {
+		sub, err := pulp.getNewSubscription(c)
+		if err != nil {
+			return false, err
+		}
+
+		if sub.Status.InstallPlanRef != nil {
+			approved, err := pulp.handleInstallPlan(c, sub.Status.InstallPlanRef.Name)
+			if err != nil {
+				return false, err
+			}
+			if !approved && notified != sub.Status.InstallPlanRef.Name {
+				notified = sub.Status.InstallPlanRef.Name
+				fmt.Println("⚠️  InstallPlan", notified, "requires approval, waiting for it to be approved manually ...")
+			}
+		}
+
+		if sub.Status.InstalledCSV == "" {
+			return false, nil
+		}
+		return pulp.csvSucceeded(c, sub.Status.InstalledCSV)
+	})
+	if err != nil {
+		fmt.Println("❌ The golang operator was not installed:", err)
+		return err
+	}
+	fmt.Println("✅ Golang operator installed")
+	return nil
+}
+
+// getNewSubscription retrieves the golang operator Subscription
+func (pulp pulp) getNewSubscription(c cluster) (*operatorsv1alpha1.Subscription, error) {
+	sub := &operatorsv1alpha1.Subscription{}
+	if err := c.Get(context.TODO(), client.ObjectKey{Namespace: pulp.newSubscriptionNamespace, Name: pulp.newSubscriptionName}, sub); err != nil {
+		return nil, fmt.Errorf("failed to get subscription %s: %w", pulp.newSubscriptionName, err)
+	}
+	return sub, nil
+}
+
+// handleInstallPlan approves the InstallPlan if it is waiting for approval,
+// auto-approval was requested, and it installs the starting CSV.
+// It returns false if the InstallPlan is still waiting for approval.
+func (pulp pulp) handleInstallPlan(c cluster, name string) (bool, error) {
+	installPlan := &operatorsv1alpha1.InstallPlan{}
+	err := c.Get(context.TODO(), client.ObjectKey{Namespace: pulp.newSubscriptionNamespace, Name: name}, installPlan)
+	// OLM can replace the InstallPlan, the Subscription will point to the new one
+	if apierrors.IsNotFound(err) {
+		return true, nil
+	} else if err != nil {
+		return false, fmt.Errorf("failed to get installplan %s: %w", name, err)
+	}
+	if installPlan.Spec.Approved {
+		return true, nil
+	}
+	if !pulp.approveInstallPlan || !installsCSV(installPlan, pulp.newSubscriptionStartingCSV) {
+		return false, nil
+	}
+
+	fmt.Println("Approving InstallPlan", name, "of", pulp.newSubscriptionStartingCSV, "...")
+	if err := pulp.patch(c, installPlan, client.RawPatch(types.MergePatchType, []byte(`{"spec":{"approved":true}}`))); err != nil {
+		fmt.Println("❌ Failed to approve InstallPlan", name+":", err)
+		return false, fmt.Errorf("failed to approve installplan %s: %w", name, err)
+	}
+	return true, nil
+}
+
+// installsCSV returns true if the InstallPlan installs only the given CSV, so
+// approving it does not install anything else (like an upgrade)
+func installsCSV(installPlan *operatorsv1alpha1.InstallPlan, csv string) bool {
+	names := installPlan.Spec.ClusterServiceVersionNames
+	return len(names) == 1 && names[0] == csv
+}
+
+// csvSucceeded returns true when the CSV phase is Succeeded and an error if it failed
+func (pulp pulp) csvSucceeded(c cluster, name string) (bool, error) {
+	csv := &operatorsv1alpha1.ClusterServiceVersion{}
+	err := c.Get(context.TODO(), client.ObjectKey{Namespace: pulp.newSubscriptionNamespace, Name: name}, csv)
+	// the CSV is created right after the Subscription status is updated
+	if apierrors.IsNotFound(err) {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("failed to get CSV %s: %w", name, err)
+	}
+	switch csv.Status.Phase {
+	case operatorsv1alpha1.CSVPhaseSucceeded:
+		return true, nil
+	case operatorsv1alpha1.CSVPhaseFailed:
+		return false, fmt.Errorf("CSV %s failed: %s", name, csv.Status.Message)
+	}
+	return false, nil
+}
+
+// waitFor calls done every 10 seconds until it returns true or an error, or
+// the timeout is reached
+func waitFor(timeout time.Duration, done func() (bool, error)) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		finished, err := done()
+		if err != nil {
+			return err
+		}
+		if finished {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out after %s", timeout)
+		}
+		time.Sleep(10 * time.Second)
+	}
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	operatorsv1 "github.com/operator-framework/api/pkg/operators/v1"
+	operatorsv1alpha1 "github.com/operator-framework/api/pkg/operators/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// operatorGroupTargets returns the namespaces watched by the operators of the
+// OperatorGroup, [""] if it selects all of them
+func operatorGroupTargets(og *operatorsv1.OperatorGroup) []string {
+	switch {
+	case len(og.Spec.TargetNamespaces) > 0:
+		return og.Spec.TargetNamespaces
+	case og.Spec.Selector != nil:
+		return og.Status.Namespaces
+	}
+	return []string{corev1.NamespaceAll}
+}
+
+// describeTargets returns a readable list of target namespaces
+func describeTargets(targets []string) string {
+	if len(targets) == 0 || (len(targets) == 1 && targets[0] == corev1.NamespaceAll) {
+		return "all namespaces"
+	}
+	return strings.Join(targets, ", ")
+}
+
+// getOperatorGroup returns the OperatorGroup of the golang operator
+// namespace, or nil if there is none.
+// OLM does not install any CSV in a namespace with more than one of them.
+func (pulp pulp) getOperatorGroup(c cluster) (*operatorsv1.OperatorGroup, error) {
+	ogList := &operatorsv1.OperatorGroupList{}
+	if err := c.List(context.TODO(), ogList, client.InNamespace(pulp.newSubscriptionNamespace)); err != nil {
+		return nil, fmt.Errorf("failed to list the operatorgroups: %w", err)
+	}
+	switch len(ogList.Items) {
+	case 0:
+		return nil, nil
+	case 1:
+		return &ogList.Items[0], nil
+	}
+	return nil, fmt.Errorf("found %d operatorgroups in %s namespace, OLM requires a single one", len(ogList.Items), pulp.newSubscriptionNamespace)
+}
+
+// installModes returns the install modes of the golang operator CSV, from
+// the PackageManifest of the CatalogSource, or nil if they are not provided
+func (pulp pulp) installModes(c cluster) (operatorsv1alpha1.InstallModeSet, error) {
+	channel, err := pulp.findChannel(c)
+	if err != nil {
+		return nil, err
+	}
+	if len(channel.CurrentCSVDesc.InstallModes) == 0 {
+		return nil, nil
+	}
+	return operatorsv1alpha1.NewInstallModeSet(channel.CurrentCSVDesc.InstallModes)
+}
+
+// supportedTargets returns the target namespaces of an OperatorGroup
+// supported by the install modes, the golang operator namespace if possible.
+// The single and multi namespace modes would need other namespaces, so they
+// are not chosen by the migrator.
+func (pulp pulp) supportedTargets(modes operatorsv1alpha1.InstallModeSet) ([]string, error) {
+	if modes[operatorsv1alpha1.InstallModeTypeOwnNamespace] {
+		return []string{pulp.newSubscriptionNamespace}, nil
+	}
+	if modes[operatorsv1alpha1.InstallModeTypeAllNamespaces] {
+		return nil, nil
+	}
+	return nil, fmt.Errorf("%s supports neither %s nor %s install modes", pulp.newSubscriptionStartingCSV, operatorsv1alpha1.InstallModeTypeOwnNamespace, operatorsv1alpha1.InstallModeTypeAllNamespaces)
+}
+
+// checkOperatorGroup verifies that the OperatorGroup of the golang operator
+// namespace supports the install modes of its CSV, or that it can be
+// created or adjusted if it was allowed
+func (pulp pulp) checkOperatorGroup(c cluster) error {
+	og, err := pulp.getOperatorGroup(c)
+	if err != nil {
+		return err
+	}
+	modes, err := pulp.installModes(c)
+	// the package is checked with the CatalogSource, which could be
+	// created from the index image later
+	if err != nil || modes == nil {
+		return nil
+	}
+
+	if og != nil {
+		err = modes.Supports(pulp.newSubscriptionNamespace, operatorGroupTargets(og))
+		if err == nil {
+			return nil
+		}
+		err = fmt.Errorf("operatorgroup %s does not support %s: %w", og.Name, pulp.newSubscriptionStartingCSV, err)
+	} else {
+		err = fmt.Errorf("no operatorgroup found in %s namespace", pulp.newSubscriptionNamespace)
+	}
+	if !pulp.adjustOperatorGroup {
+		return fmt.Errorf("%w, set ADJUST_OPERATOR_GROUP to let the migrator fix it", err)
+	}
+	_, err = pulp.supportedTargets(modes)
+	return err
+}
+
+// prepareOperatorGroup verifies that the OperatorGroup of the golang operator
+// namespace supports the install modes of its CSV, otherwise the CSV would
+// fail with UnsupportedOperatorGroup. If allowed, the OperatorGroup is
+// created, or its target namespaces are changed, to support them.
+func (pulp pulp) prepareOperatorGroup(c cluster) error {
+	fmt.Println("🔎 Verifying the OperatorGroup of", pulp.newSubscriptionNamespace, "namespace ...")
+	og, err := pulp.getOperatorGroup(c)
+	if err != nil {
+		fmt.Println("❌ Failed to find the OperatorGroup:", err)
+		return err
+	}
+	modes, err := pulp.installModes(c)
+	if err != nil {
+		fmt.Println("❌ Failed to find the install modes of "+pulp.newSubscriptionStartingCSV+":", err)
+		return fmt.Errorf("failed to find the install modes of %s: %w", pulp.newSubscriptionStartingCSV, err)
+	}
+	if modes == nil {
+		fmt.Println("⚠️  The install modes of", pulp.newSubscriptionStartingCSV, "are not in the package manifest, the OperatorGroup is not verified")
+		return nil
+	}
+
+	if og != nil {
+		err := modes.Supports(pulp.newSubscriptionNamespace, operatorGroupTargets(og))
+		if err == nil {
+			fmt.Println("✅ OperatorGroup", og.Name, "supports", pulp.newSubscriptionStartingCSV)
+			return nil
+		}
+		fmt.Println("⚠️  OperatorGroup", og.Name, "does not support", pulp.newSubscriptionStartingCSV+":", err)
+		if !pulp.adjustOperatorGroup {
+			fmt.Println("❌ OperatorGroup", og.Name, "should be adjusted, or ADJUST_OPERATOR_GROUP set to let the migrator do it")
+			return fmt.Errorf("operatorgroup %s does not support %s: %w", og.Name, pulp.newSubscriptionStartingCSV, err)
+		}
+	} else if !pulp.adjustOperatorGroup {
+		fmt.Println("❌ No OperatorGroup found in", pulp.newSubscriptionNamespace, "namespace, it should be created, or ADJUST_OPERATOR_GROUP set to let the migrator do it")
+		return fmt.Errorf("no operatorgroup found in %s namespace", pulp.newSubscriptionNamespace)
+	}
+
+	targets, err := pulp.supportedTargets(modes)
+	if err != nil {
+		fmt.Println("❌ Failed to find a supported OperatorGroup:", err)
+		return err
+	}
+	if og == nil {
+		return pulp.createOperatorGroup(c, targets)
+	}
+	return pulp.updateOperatorGroup(c, og, targets)
+}
+
+// createOperatorGroup creates the OperatorGroup of the golang operator namespace
+func (pulp pulp) createOperatorGroup(c cluster, targets []string) error {
+	fmt.Println("Creating", pulp.newSubscriptionName, "OperatorGroup watching", describeTargets(targets), "...")
+	og := &operatorsv1.OperatorGroup{
+		ObjectMeta: metav1.ObjectMeta{Name: pulp.newSubscriptionName, Namespace: pulp.newSubscriptionNamespace},
+		Spec:       operatorsv1.OperatorGroupSpec{TargetNamespaces: targets},
+	}
+	if err := pulp.create(c, og); err != nil {
+		fmt.Println("❌ Failed to create OperatorGroup:", err)
+		return fmt.Errorf("failed to create operatorgroup %s: %w", og.Name, err)
+	}
+	pulp.original.OperatorGroupCreated = true
+	return nil
+}
+
+// updateOperatorGroup replaces the target namespaces of the OperatorGroup
+func (pulp pulp) updateOperatorGroup(c cluster, og *operatorsv1.OperatorGroup, targets []string) error {
+	fmt.Println("Updating", og.Name, "OperatorGroup to watch", describeTargets(targets), "instead of", describeTargets(operatorGroupTargets(og)), "...")
+	pulp.original.OperatorGroup = og
+	if err := pulp.patchOperatorGroup(c, og.Name, targets, nil); err != nil {
+		fmt.Println("❌ Failed to update OperatorGroup:", err)
+		return fmt.Errorf("failed to update operatorgroup %s: %w", og.Name, err)
+	}
+	return nil
+}
+
+// patchOperatorGroup sets the target namespaces and selector of the OperatorGroup
+func (pulp pulp) patchOperatorGroup(c cluster, name string, targets []string, selector *metav1.LabelSelector) error {
+	patch, err := json.Marshal(map[string]any{
+		"spec": map[string]any{"targetNamespaces": targets, "selector": selector},
+	})
+	if err != nil {
+		return err
+	}
+	og := &operatorsv1.OperatorGroup{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: pulp.newSubscriptionNamespace}}
+	return pulp.patch(c, og, client.RawPatch(types.MergePatchType, patch))
+}
+
+// restoreOperatorGroup reverts the changes made by prepareOperatorGroup
+func (pulp pulp) restoreOperatorGroup(c cluster) error {
+	if pulp.original.OperatorGroupCreated {
+		og := &operatorsv1.OperatorGroup{ObjectMeta: metav1.ObjectMeta{Name: pulp.newSubscriptionName, Namespace: pulp.newSubscriptionNamespace}}
+		if err := pulp.delete(c, og); err != nil && !isMissing(err) {
+			return fmt.Errorf("failed to delete operatorgroup %s: %w", og.Name, err)
+		}
+	}
+	if og := pulp.original.OperatorGroup; og != nil {
+		if err := pulp.patchOperatorGroup(c, og.Name, og.Spec.TargetNamespaces, og.Spec.Selector); err != nil {
+			return fmt.Errorf("failed to restore operatorgroup %s: %w", og.Name, err)
+		}
+	}
+	return nil
+}
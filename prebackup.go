@@ -0,0 +1,279 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"migrator/conversion"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// methods of the pre-migration backup
+const (
+	backupNone   = "none"
+	backupCR     = "cr"
+	backupPGDump = "pg-dump"
+)
+
+// backupAnnotation is added to the ansible Pulp CR with the location of the
+// pre-migration backup, and to the ansible backup CR created for it
+const backupAnnotation = "pulp-migrator/pre-migration-backup"
+
+// defaults of the pg_dump Job, the same used by the ansible operator for the
+// database pods
+const (
+	defaultPostgresImage   = "postgres:13"
+	defaultPostgresStorage = "8Gi"
+)
+
+// preMigrationBackupName returns the name of the resources created by the
+// pre-migration backup
+func (pulp pulp) preMigrationBackupName() string {
+	return pulp.oldResourceName + "-pre-migration-backup"
+}
+
+// preMigrationBackup backs up the current installation before any resource is
+// changed, through an ansible PulpBackup CR or a pg_dump Job, and waits for it.
+// The migration is aborted if the backup fails.
+func (pulp pulp) preMigrationBackup(c cluster) error {
+	var location string
+	var err error
+	switch pulp.backupMethod {
+	case backupCR:
+		location, err = pulp.backupWithCR(c)
+	case backupPGDump:
+		location, err = pulp.backupWithPGDump(c)
+	default:
+		return nil
+	}
+	if err != nil {
+		fmt.Println("❌ Pre-migration backup failed, aborting the migration:", err)
+		return err
+	}
+	if pulp.dryRun {
+		return nil
+	}
+
+	fmt.Println("✅ Pre-migration backup stored in", location)
+	patch, err := json.Marshal(map[string]any{
+		"metadata": map[string]any{"annotations": map[string]string{backupAnnotation: location}},
+	})
+	if err != nil {
+		return err
+	}
+	cr := newUnstructured(pulp.oldApi, pulp.Kind)
+	cr.SetName(pulp.oldResourceName)
+	cr.SetNamespace(pulp.oldSubscriptionNamespace)
+	if err := pulp.patch(c, cr, client.RawPatch(types.MergePatchType, patch)); err != nil {
+		fmt.Println("❌ Failed to annotate "+pulp.oldResourceName+" with the backup location:", err)
+		return fmt.Errorf("failed to annotate %s %s: %w", pulp.Kind, pulp.oldResourceName, err)
+	}
+	return nil
+}
+
+// backupWithCR creates an ansible PulpBackup CR (GalaxyBackup for Galaxy CRs)
+// and waits for the ansible operator to finish it
+func (pulp pulp) backupWithCR(c cluster) (string, error) {
+	// the ansible operator is removed with the subscription shared by a Pulp
+	// CR migrated before this one, so nobody would reconcile the backup
+	if pulp.sharedSubscription {
+		return "", fmt.Errorf("the ansible operator was already removed by a previous migration, use the %s backup instead", backupPGDump)
+	}
+
+	kind := pulp.Kind + "Backup"
+	name := pulp.preMigrationBackupName()
+	fmt.Println("💾 Creating", kind, name, "...")
+	cr, err := toUnstructured(map[string]any{
+		"apiVersion": pulp.oldApi,
+		"kind":       kind,
+		"metadata": metav1.ObjectMeta{
+			Name:        name,
+			Namespace:   pulp.oldSubscriptionNamespace,
+			Annotations: map[string]string{backupAnnotation: pulp.oldResourceName},
+		},
+		"spec": conversion.AnsibleBackupSpec{
+			DeploymentType: pulp.Spec.DeploymentType,
+			DeploymentName: pulp.oldResourceName,
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+	err = pulp.createBackupAttempt(c, cr, func(obj client.Object) (bool, error) {
+		backup := &ansibleBackup{}
+		if err := fromUnstructured(obj.(*unstructured.Unstructured).Object, backup); err != nil {
+			return false, fmt.Errorf("failed to read %s %s: %w", kind, obj.GetName(), err)
+		}
+		return backup.Status.Failed(), nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to create %s %s: %w", kind, name, err)
+	}
+	if pulp.dryRun {
+		return "", nil
+	}
+	name = cr.GetName()
+
+	fmt.Println("Waiting for", kind, name, "to finish ...")
+	backup := &ansibleBackup{}
+	err = waitFor(pulp.backupTimeout, func() (bool, error) {
+		if err := c.Get(context.TODO(), client.ObjectKeyFromObject(cr), cr); err != nil {
+			return false, fmt.Errorf("failed to get %s %s: %w", kind, name, err)
+		}
+		if err := fromUnstructured(cr.Object, backup); err != nil {
+			return false, fmt.Errorf("failed to read %s %s: %w", kind, name, err)
+		}
+		if backup.Status.Failed() {
+			return false, fmt.Errorf("%s %s failed, check the ansible operator logs", kind, name)
+		}
+		return backup.Status.Completed(), nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s %s (PVC %s, directory %s)", kind, name, backup.Status.BackupClaim, backup.Status.BackupDirectory), nil
+}
+
+// backupWithPGDump runs a Job that dumps the current database (through the
+// credentials of the postgres configuration secret) into a new PVC, and waits
+// for it to finish
+func (pulp pulp) backupWithPGDump(c cluster) (string, error) {
+	name := pulp.preMigrationBackupName()
+	dumpFile := "/backup/" + pulp.oldResourceName + ".dump"
+
+	fmt.Println("💾 Creating", name, "PVC ...")
+	storage := resource.MustParse(defaultPostgresStorage)
+	if requirements := pulp.Spec.PostgresStorageRequirements; requirements != nil {
+		if request, ok := requirements.Requests[corev1.ResourceStorage]; ok {
+			storage = request
+		}
+	}
+	pvc := &corev1.PersistentVolumeClaim{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "PersistentVolumeClaim"},
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: pulp.oldSubscriptionNamespace},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			AccessModes:      []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+			StorageClassName: pulp.Spec.PostgresStorageClass,
+			Resources: corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{corev1.ResourceStorage: storage},
+			},
+		},
+	}
+	if err := pulp.create(c, pvc); err != nil && !apierrors.IsAlreadyExists(err) {
+		return "", fmt.Errorf("failed to create PVC %s: %w", name, err)
+	}
+
+	fmt.Println("💾 Creating", name, "Job ...")
+	image := pulp.Spec.PostgresImage
+	if image == "" {
+		image = defaultPostgresImage
+	}
+	secret := pulp.postgresConfigurationSecretName()
+	env := []corev1.EnvVar{}
+	for _, v := range []struct {
+		name, key string
+		optional  bool
+	}{
+		{"PGHOST", "host", false},
+		{"PGPORT", "port", false},
+		{"PGUSER", "username", false},
+		{"PGPASSWORD", "password", false},
+		{"PGDATABASE", "database", false},
+		{"PGSSLMODE", "sslmode", true},
+	} {
+		optional := v.optional
+		env = append(env, corev1.EnvVar{
+			Name: v.name,
+			ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: secret},
+				Key:                  v.key,
+				Optional:             &optional,
+			}},
+		})
+	}
+	backoffLimit := int32(0)
+	job := &batchv1.Job{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "batch/v1", Kind: "Job"},
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: pulp.oldSubscriptionNamespace},
+		Spec: batchv1.JobSpec{
+			BackoffLimit: &backoffLimit,
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					RestartPolicy: corev1.RestartPolicyNever,
+					Containers: []corev1.Container{{
+						Name:         "pg-dump",
+						Image:        image,
+						Command:      []string{"pg_dump", "--format=custom", "--file=" + dumpFile},
+						Env:          env,
+						VolumeMounts: []corev1.VolumeMount{{Name: "backup", MountPath: "/backup"}},
+					}},
+					Volumes: []corev1.Volume{{
+						Name: "backup",
+						VolumeSource: corev1.VolumeSource{
+							PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: name},
+						},
+					}},
+				},
+			},
+		},
+	}
+	err := pulp.createBackupAttempt(c, job, func(obj client.Object) (bool, error) {
+		return obj.(*batchv1.Job).Status.Failed > 0, nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to create job %s: %w", name, err)
+	}
+	if pulp.dryRun {
+		return "", nil
+	}
+	name = job.Name
+
+	fmt.Println("Waiting for", name, "Job to finish ...")
+	err = waitFor(pulp.backupTimeout, func() (bool, error) {
+		if err := c.Get(context.TODO(), client.ObjectKeyFromObject(job), job); err != nil {
+			return false, fmt.Errorf("failed to get job %s: %w", name, err)
+		}
+		if job.Status.Failed > 0 {
+			return false, fmt.Errorf("%s Job failed, check the logs of its pod", name)
+		}
+		return job.Status.Succeeded > 0, nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("PVC %s, file %s", pvc.Name, dumpFile), nil
+}
+
+// createBackupAttempt creates obj, the Job or CR of the pre-migration backup.
+// The one left by a previous run is waited for again, unless it failed: then
+// a new attempt is created with the number of the attempt as a suffix
+// (like example-pulp-pre-migration-backup-2), so the failed one is kept to
+// be inspected.
+func (pulp pulp) createBackupAttempt(c cluster, obj client.Object, failed func(client.Object) (bool, error)) error {
+	name := obj.GetName()
+	for attempt := 2; ; attempt++ {
+		err := pulp.create(c, obj)
+		if !apierrors.IsAlreadyExists(err) {
+			return err
+		}
+
+		existing := obj.DeepCopyObject().(client.Object)
+		if err := c.Get(context.TODO(), client.ObjectKeyFromObject(obj), existing); err != nil {
+			return err
+		}
+		if retry, err := failed(existing); err != nil || !retry {
+			return err
+		}
+		fmt.Println("⚠️ ", describe(c, obj), "failed in a previous run, retrying ...")
+		obj.SetName(fmt.Sprintf("%s-%d", name, attempt))
+	}
+}
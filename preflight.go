@@ -0,0 +1,417 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	operatorsv1alpha1 "github.com/operator-framework/api/pkg/operators/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// preflightCheck is one of the verifications done before the migration starts
+type preflightCheck struct {
+	name string
+	run  func() error
+}
+
+// packageManifest holds the fields of a packages.operators.coreos.com/v1
+// PackageManifest used by the pre-flight checks
+type packageManifest struct {
+	metav1.ObjectMeta `json:"metadata"`
+	Status            struct {
+		CatalogSource          string           `json:"catalogSource"`
+		CatalogSourceNamespace string           `json:"catalogSourceNamespace"`
+		Channels               []packageChannel `json:"channels"`
+	} `json:"status"`
+}
+
+// packageChannel is a channel of a PackageManifest
+type packageChannel struct {
+	Name           string `json:"name"`
+	CurrentCSV     string `json:"currentCSV"`
+	CurrentCSVDesc struct {
+		InstallModes []operatorsv1alpha1.InstallMode `json:"installModes"`
+	} `json:"currentCSVDesc"`
+	Entries []struct {
+		Name string `json:"name"`
+	} `json:"entries"`
+}
+
+// permission is a request made by the migrator that should be allowed by RBAC
+type permission struct {
+	verb      string
+	group     string
+	resource  string
+	namespace string
+}
+
+// preflight verifies that the cluster is ready to be migrated before
+// anything is changed. Every check is run, so all the problems found are
+// reported at once.
+func (pulp pulp) preflight(c cluster, runOnlyConvertion bool) error {
+	fmt.Println("🔎 Running pre-flight checks ...")
+
+	checks := []preflightCheck{
+		{"ansible Pulp CR " + pulp.oldResourceName + " is reconciled", func() error { return pulp.checkAnsibleCRReconciled() }},
+	}
+	if !pulp.externalDB {
+		checks = append(checks, preflightCheck{"a single database PVC is found", func() error {
+			return pulp.checkSingleDBResource(c, &corev1.PersistentVolumeClaimList{}, "PVCs")
+		}})
+	}
+	if !runOnlyConvertion {
+		if !pulp.externalDB {
+			checks = append(checks, []preflightCheck{
+				{"a single database Service is found", func() error { return pulp.checkSingleDBResource(c, &corev1.ServiceList{}, "Services") }},
+				{"a single database StatefulSet is found", func() error { return pulp.checkSingleDBResource(c, &appsv1.StatefulSetList{}, "StatefulSets") }},
+			}...)
+		}
+		if !pulp.sharedSubscription && pulp.withoutOLM {
+			checks = append(checks, preflightCheck{"ansible operator " + pulp.oldSubscriptionName + " deployment is found", func() error { return pulp.checkAnsibleOperator(c) }})
+		} else if !pulp.sharedSubscription {
+			checks = append(checks, preflightCheck{"Subscription " + pulp.oldSubscriptionName + " has a current CSV", func() error { return pulp.checkCurrentCSV(c) }})
+		}
+		if !pulp.sharedSubscription && pulp.installManifests {
+			checks = append(checks, preflightCheck{"golang operator manifests can be applied", func() error { return pulp.checkOperatorManifests(c) }})
+		} else if !pulp.sharedSubscription && pulp.indexImage != "" {
+			checks = append(checks, preflightCheck{"CatalogSource " + pulp.newSubscriptionSource + " can be created from " + pulp.indexImage, func() error { return pulp.checkIndexImage(c) }})
+		} else if !pulp.sharedSubscription {
+			checks = append(checks, preflightCheck{"CatalogSource " + pulp.newSubscriptionSource + " provides " + pulp.newSubscriptionStartingCSV + " in " + pulp.newSubscriptionChannel + " channel", func() error { return pulp.checkCatalogSource(c) }})
+		}
+		if !pulp.sharedSubscription && !pulp.installManifests {
+			name := "OperatorGroup of " + pulp.newSubscriptionNamespace + " namespace supports " + pulp.newSubscriptionStartingCSV
+			if pulp.adjustOperatorGroup {
+				name += " or can be adjusted"
+			}
+			checks = append(checks, preflightCheck{name, func() error { return pulp.checkOperatorGroup(c) }})
+		}
+	}
+	checks = append(checks, []preflightCheck{
+		{"golang Pulp CR " + pulp.newResourceName + " does not exist", func() error { return pulp.checkNewCRNotFound(c) }},
+		{"RBAC allows the requests made by the migrator", func() error { return pulp.checkPermissions(c, runOnlyConvertion) }},
+	}...)
+
+	failed := 0
+	for _, check := range checks {
+		if err := check.run(); err != nil {
+			fmt.Println("  ❌", check.name+":", err)
+			failed++
+			continue
+		}
+		fmt.Println("  ✅", check.name)
+	}
+	if failed > 0 {
+		fmt.Println("❌ Pre-flight checks failed, nothing was changed in the cluster")
+		return fmt.Errorf("%d pre-flight checks failed", failed)
+	}
+	fmt.Println("✅ Pre-flight checks passed")
+	return nil
+}
+
+// checkAnsibleCRReconciled verifies that the last reconciliation of the
+// ansible Pulp CR finished successfully
+func (pulp pulp) checkAnsibleCRReconciled() error {
+	data, err := json.Marshal(pulp.Status)
+	if err != nil {
+		return err
+	}
+	status := struct {
+		Conditions []metav1.Condition `json:"conditions"`
+	}{}
+	if err := json.Unmarshal(data, &status); err != nil {
+		return fmt.Errorf("failed to read the status: %w", err)
+	}
+
+	reconciled := false
+	for _, condition := range status.Conditions {
+		switch {
+		case condition.Type == "Failure" && condition.Status == metav1.ConditionTrue:
+			return fmt.Errorf("last reconciliation failed: %s", condition.Message)
+		case condition.Type == "Successful" && condition.Status == metav1.ConditionTrue,
+			condition.Type == "Running" && condition.Reason == "Successful":
+			reconciled = true
+		}
+	}
+	if !reconciled {
+		return fmt.Errorf("the operator did not finish reconciling it")
+	}
+	return nil
+}
+
+// checkSingleDBResource verifies that exactly one resource matches the
+// database label selector of the Pulp CR
+func (pulp pulp) checkSingleDBResource(c cluster, list client.ObjectList, resource string) error {
+	if err := c.List(context.TODO(), list, client.InNamespace(pulp.oldSubscriptionNamespace), pulp.dbLabels()); err != nil {
+		return fmt.Errorf("failed to list %s: %w", resource, err)
+	}
+	items, err := meta.ExtractList(list)
+	if err != nil {
+		return err
+	}
+	if len(items) != 1 {
+		return fmt.Errorf("found %d %s", len(items), resource)
+	}
+	return nil
+}
+
+// checkCurrentCSV verifies that the ansible operator Subscription has a CSV installed
+func (pulp pulp) checkCurrentCSV(c cluster) error {
+	sub := &operatorsv1alpha1.Subscription{}
+	err := c.Get(context.TODO(), client.ObjectKey{Namespace: pulp.oldSubscriptionNamespace, Name: pulp.oldSubscriptionName}, sub)
+	if apierrors.IsNotFound(err) {
+		return fmt.Errorf("subscription not found")
+	} else if err != nil {
+		return fmt.Errorf("failed to get the subscription: %w", err)
+	}
+	if sub.Status.CurrentCSV == "" {
+		return fmt.Errorf("status.currentCSV is empty")
+	}
+	return nil
+}
+
+// checkAnsibleOperator verifies that the controller Deployment of the ansible
+// operator deployed without OLM is found
+func (pulp pulp) checkAnsibleOperator(c cluster) error {
+	deployment, err := findAnsibleOperator(c, pulp.oldSubscriptionNamespace, pulp.oldSubscriptionName)
+	if err != nil {
+		return err
+	}
+	if deployment == nil {
+		return fmt.Errorf("no deployment with %v labels found", map[string]string(controllerLabels))
+	}
+	return nil
+}
+
+// checkCatalogSource verifies that the CatalogSource exists and provides the
+// golang operator starting CSV in the subscription channel
+func (pulp pulp) checkCatalogSource(c cluster) error {
+	err := c.Get(context.TODO(), client.ObjectKey{Namespace: pulp.newSubscriptionSourceNamespace, Name: pulp.newSubscriptionSource}, &operatorsv1alpha1.CatalogSource{})
+	if apierrors.IsNotFound(err) {
+		return fmt.Errorf("catalogsource not found in %s namespace", pulp.newSubscriptionSourceNamespace)
+	} else if err != nil {
+		return fmt.Errorf("failed to get the catalogsource: %w", err)
+	}
+	return pulp.checkPackage(c)
+}
+
+// checkPackage verifies that the PackageManifest of the CatalogSource
+// provides the golang operator starting CSV in the subscription channel
+func (pulp pulp) checkPackage(c cluster) error {
+	channel, err := pulp.findChannel(c)
+	if err != nil {
+		return err
+	}
+	if channel.CurrentCSV == pulp.newSubscriptionStartingCSV {
+		return nil
+	}
+	for _, entry := range channel.Entries {
+		if entry.Name == pulp.newSubscriptionStartingCSV {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s not found in %s channel", pulp.newSubscriptionStartingCSV, pulp.newSubscriptionChannel)
+}
+
+// findChannel returns the subscription channel of the golang operator
+// PackageManifest served by the CatalogSource
+func (pulp pulp) findChannel(c cluster) (*packageChannel, error) {
+	list := newUnstructuredList("packages.operators.coreos.com/v1", "PackageManifest")
+	err := c.List(context.TODO(), list, client.InNamespace(pulp.newSubscriptionNamespace), client.MatchingLabels{
+		"catalog":           pulp.newSubscriptionSource,
+		"catalog-namespace": pulp.newSubscriptionSourceNamespace,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the packagemanifests: %w", err)
+	}
+	packages := []packageManifest{}
+	if err := fromUnstructured(list.UnstructuredContent()["items"], &packages); err != nil {
+		return nil, fmt.Errorf("failed to read the packagemanifests: %w", err)
+	}
+
+	for _, pkg := range packages {
+		if pkg.Name != pulp.newSubscriptionName {
+			continue
+		}
+		for i := range pkg.Status.Channels {
+			if pkg.Status.Channels[i].Name == pulp.newSubscriptionChannel {
+				return &pkg.Status.Channels[i], nil
+			}
+		}
+		return nil, fmt.Errorf("channel %s not found in %s package", pulp.newSubscriptionChannel, pulp.newSubscriptionName)
+	}
+	return nil, fmt.Errorf("package %s not found", pulp.newSubscriptionName)
+}
+
+// checkNewCRNotFound verifies that there is no golang Pulp CR with the same name
+func (pulp pulp) checkNewCRNotFound(c cluster) error {
+	cr := newUnstructured(pulp.newApi, pulp.newKind)
+	err := c.Get(context.TODO(), client.ObjectKey{Namespace: pulp.newSubscriptionNamespace, Name: pulp.newResourceName}, cr)
+	// the golang CRD is probably not installed yet
+	if isMissing(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to get %s %s: %w", pulp.newKind, pulp.newResourceName, err)
+	}
+	return fmt.Errorf("%s %s already exists in %s namespace", pulp.newKind, pulp.newResourceName, pulp.newSubscriptionNamespace)
+}
+
+// checkPermissions verifies through SelfSubjectAccessReviews that the
+// service account running the migrator is allowed to make each request
+func (pulp pulp) checkPermissions(c cluster, runOnlyConvertion bool) error {
+	newGroup, _, _ := strings.Cut(pulp.newApi, "/")
+	oldGroup, _, _ := strings.Cut(pulp.oldApi, "/")
+	permissions := []permission{
+		{"get", oldGroup, pulp.oldResource, pulp.oldSubscriptionNamespace},
+		{"list", "", "persistentvolumeclaims", pulp.oldSubscriptionNamespace},
+		// also used to find out if the database is external
+		{"list", "apps", "statefulsets", pulp.oldSubscriptionNamespace},
+		{"create", newGroup, pulp.newResource, pulp.newSubscriptionNamespace},
+		{"get", "", "configmaps", pulp.oldSubscriptionNamespace},
+		{"create", "", "configmaps", pulp.oldSubscriptionNamespace},
+		{"update", "", "configmaps", pulp.oldSubscriptionNamespace},
+		{"delete", "", "configmaps", pulp.oldSubscriptionNamespace},
+	}
+	switch strings.ToLower(pulp.Spec.IngressType) {
+	case "route":
+		permissions = append(permissions, permission{"list", "route.openshift.io", "routes", pulp.oldSubscriptionNamespace})
+	case "ingress":
+		permissions = append(permissions, permission{"list", "networking.k8s.io", "ingresses", pulp.oldSubscriptionNamespace})
+	}
+	if pulp.externalDB || pulp.externalCache {
+		permissions = append(permissions, []permission{
+			{"get", "", "secrets", pulp.oldSubscriptionNamespace},
+			{"create", "", "secrets", pulp.newSubscriptionNamespace},
+		}...)
+	}
+	// convertBackups, the CRDs of the backups are optional
+	permissions = append(permissions, []permission{
+		{"list", oldGroup, strings.ToLower(pulp.Kind) + "backups", pulp.oldSubscriptionNamespace},
+		{"list", oldGroup, strings.ToLower(pulp.Kind) + "restores", pulp.oldSubscriptionNamespace},
+		{"create", newGroup, strings.ToLower(pulp.newKind) + "backups", pulp.newSubscriptionNamespace},
+	}...)
+	if pulp.convertRestores {
+		permissions = append(permissions, permission{"create", newGroup, strings.ToLower(pulp.newKind) + "restores", pulp.newSubscriptionNamespace})
+	}
+	if !runOnlyConvertion {
+		permissions = append(permissions, []permission{
+			{"list", "", "services", pulp.oldSubscriptionNamespace},
+			{"patch", "", "services", pulp.oldSubscriptionNamespace},
+			{"patch", "apps", "statefulsets/scale", pulp.oldSubscriptionNamespace},
+			{"get", "apps", "deployments", pulp.oldSubscriptionNamespace},
+			{"delete", "apps", "deployments", pulp.oldSubscriptionNamespace},
+		}...)
+		if pulp.installManifests {
+			permissions = append(permissions, pulp.manifestsPermissions(c)...)
+		} else {
+			permissions = append(permissions, []permission{
+				{"list", "operators.coreos.com", "operatorgroups", pulp.newSubscriptionNamespace},
+				{"list", "packages.operators.coreos.com", "packagemanifests", pulp.newSubscriptionNamespace},
+				{"create", "operators.coreos.com", "subscriptions", pulp.newSubscriptionNamespace},
+				{"get", "operators.coreos.com", "subscriptions", pulp.newSubscriptionNamespace},
+				{"get", "operators.coreos.com", "installplans", pulp.newSubscriptionNamespace},
+				{"get", "operators.coreos.com", "clusterserviceversions", pulp.newSubscriptionNamespace},
+			}...)
+		}
+		if pulp.withoutOLM {
+			permissions = append(permissions, []permission{
+				{"delete", "apps", "deployments", pulp.oldSubscriptionNamespace},
+				{"get", "", "serviceaccounts", pulp.oldSubscriptionNamespace},
+				{"delete", "", "serviceaccounts", pulp.oldSubscriptionNamespace},
+				{"get", "rbac.authorization.k8s.io", "roles", pulp.oldSubscriptionNamespace},
+				{"delete", "rbac.authorization.k8s.io", "roles", pulp.oldSubscriptionNamespace},
+				{"list", "rbac.authorization.k8s.io", "rolebindings", pulp.oldSubscriptionNamespace},
+				{"delete", "rbac.authorization.k8s.io", "rolebindings", pulp.oldSubscriptionNamespace},
+			}...)
+		} else {
+			permissions = append(permissions, []permission{
+				{"get", "operators.coreos.com", "subscriptions", pulp.oldSubscriptionNamespace},
+				{"delete", "operators.coreos.com", "subscriptions", pulp.oldSubscriptionNamespace},
+				{"delete", "operators.coreos.com", "clusterserviceversions", pulp.oldSubscriptionNamespace},
+			}...)
+		}
+		if pulp.indexImage != "" && !pulp.installManifests {
+			permissions = append(permissions, []permission{
+				{"get", "operators.coreos.com", "catalogsources", pulp.newSubscriptionSourceNamespace},
+				{"create", "operators.coreos.com", "catalogsources", pulp.newSubscriptionSourceNamespace},
+			}...)
+		}
+		if pulp.verifyTimeout > 0 {
+			permissions = append(permissions, []permission{
+				{"get", newGroup, pulp.newResource, pulp.newSubscriptionNamespace},
+				{"get", "apps", "deployments", pulp.newSubscriptionNamespace},
+				{"get", "apps", "statefulsets", pulp.newSubscriptionNamespace},
+				{"list", "", "pods", pulp.newSubscriptionNamespace},
+				{"get", "", "services/proxy", pulp.newSubscriptionNamespace},
+			}...)
+		}
+		// the web pods are verified unless the ingress class is nginx
+		if pulp.verifyTimeout > 0 && strings.ToLower(pulp.Spec.IngressType) != "route" {
+			permissions = append(permissions, permission{"get", "networking.k8s.io", "ingressclasses", ""})
+		}
+		if pulp.adjustOperatorGroup && !pulp.installManifests {
+			permissions = append(permissions, []permission{
+				{"create", "operators.coreos.com", "operatorgroups", pulp.newSubscriptionNamespace},
+				{"patch", "operators.coreos.com", "operatorgroups", pulp.newSubscriptionNamespace},
+			}...)
+		}
+		if pulp.approveInstallPlan && !pulp.installManifests {
+			permissions = append(permissions, permission{"patch", "operators.coreos.com", "installplans", pulp.newSubscriptionNamespace})
+		}
+		switch pulp.backupMethod {
+		case backupCR:
+			permissions = append(permissions, []permission{
+				{"create", oldGroup, strings.ToLower(pulp.Kind) + "backups", pulp.oldSubscriptionNamespace},
+				{"get", oldGroup, strings.ToLower(pulp.Kind) + "backups", pulp.oldSubscriptionNamespace},
+				{"patch", oldGroup, pulp.oldResource, pulp.oldSubscriptionNamespace},
+			}...)
+		case backupPGDump:
+			permissions = append(permissions, []permission{
+				{"create", "", "persistentvolumeclaims", pulp.oldSubscriptionNamespace},
+				{"create", "batch", "jobs", pulp.oldSubscriptionNamespace},
+				{"get", "batch", "jobs", pulp.oldSubscriptionNamespace},
+				{"patch", oldGroup, pulp.oldResource, pulp.oldSubscriptionNamespace},
+			}...)
+		}
+		if pulp.rollbackOnFailure {
+			permissions = append(permissions, pulp.rollbackPermissions(c)...)
+		}
+	}
+
+	denied := []string{}
+	for _, p := range permissions {
+		resource, subresource, _ := strings.Cut(p.resource, "/")
+		review := &authorizationv1.SelfSubjectAccessReview{
+			TypeMeta: metav1.TypeMeta{
+				APIVersion: "authorization.k8s.io/v1",
+				Kind:       "SelfSubjectAccessReview",
+			},
+			Spec: authorizationv1.SelfSubjectAccessReviewSpec{
+				ResourceAttributes: &authorizationv1.ResourceAttributes{
+					Namespace:   p.namespace,
+					Verb:        p.verb,
+					Group:       p.group,
+					Resource:    resource,
+					Subresource: subresource,
+				},
+			},
+		}
+		if err := c.Create(context.TODO(), review); err != nil {
+			return fmt.Errorf("failed to create selfsubjectaccessreview: %w", err)
+		}
+		if !review.Status.Allowed {
+			denied = append(denied, p.verb+" "+p.resource)
+		}
+	}
+	if len(denied) > 0 {
+		return fmt.Errorf("not allowed to %s", strings.Join(denied, ", "))
+	}
+	return nil
+}
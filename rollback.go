@@ -0,0 +1,293 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	operatorsv1 "github.com/operator-framework/api/pkg/operators/v1"
+	operatorsv1alpha1 "github.com/operator-framework/api/pkg/operators/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// originalState holds the state of the resources the migrator is about to
+// change and which of the changes were already made, so they can be
+// reverted in case of failure.
+type originalState struct {
+	// data gathered before changing the resources
+	Subscription    *operatorsv1alpha1.Subscription `json:"subscription,omitempty"`
+	CSVName         string                          `json:"csvName,omitempty"`
+	ServiceSelector map[string]string               `json:"serviceSelector,omitempty"`
+	StsReplicas     int32                           `json:"stsReplicas,omitempty"`
+	Deployments     []appsv1.Deployment             `json:"deployments,omitempty"`
+	AnsibleOperator *ansibleOperator                `json:"ansibleOperator,omitempty"`
+	OperatorGroup   *operatorsv1.OperatorGroup      `json:"operatorGroup,omitempty"`
+
+	// objects created from the golang operator manifests
+	OperatorObjects []corev1.ObjectReference `json:"operatorObjects,omitempty"`
+
+	// steps already done
+	SubscriptionDeleted        bool `json:"subscriptionDeleted,omitempty"`
+	AnsibleOperatorDeleted     bool `json:"ansibleOperatorDeleted,omitempty"`
+	DeploymentsDeleted         bool `json:"deploymentsDeleted,omitempty"`
+	StsDownscaled              bool `json:"stsDownscaled,omitempty"`
+	ServiceUpdated             bool `json:"serviceUpdated,omitempty"`
+	NewSubscriptionCreated     bool `json:"newSubscriptionCreated,omitempty"`
+	CatalogSourceCreated       bool `json:"catalogSourceCreated,omitempty"`
+	OperatorGroupCreated       bool `json:"operatorGroupCreated,omitempty"`
+	ExternalDBSecretCreated    bool `json:"externalDBSecretCreated,omitempty"`
+	ExternalCacheSecretCreated bool `json:"externalCacheSecretCreated,omitempty"`
+	GolangCRCreated            bool `json:"golangCRCreated,omitempty"`
+}
+
+// recordDeployment stores the manifest of the deployment that is about
+// to be deleted
+func (pulp pulp) recordDeployment(c cluster, name string) error {
+	deployment := appsv1.Deployment{}
+	err := c.Get(context.TODO(), client.ObjectKey{Namespace: pulp.oldSubscriptionNamespace, Name: name}, &deployment)
+	if apierrors.IsNotFound(err) {
+		// not deployed for this CR, or already deleted by a previous run
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	// when resuming a migration it could already be recorded
+	for _, d := range pulp.original.Deployments {
+		if d.Name == deployment.Name {
+			return nil
+		}
+	}
+	pulp.original.Deployments = append(pulp.original.Deployments, deployment)
+	return nil
+}
+
+// rollbackPermissions returns the requests made by rollback that are not
+// already made by the migration
+func (pulp pulp) rollbackPermissions(c cluster) []permission {
+	newGroup, _, _ := strings.Cut(pulp.newApi, "/")
+	permissions := []permission{
+		{"delete", newGroup, pulp.newResource, pulp.newSubscriptionNamespace},
+		{"list", "", "pods", pulp.newSubscriptionNamespace},
+		{"create", "apps", "deployments", pulp.oldSubscriptionNamespace},
+	}
+	if pulp.externalDB || pulp.externalCache {
+		permissions = append(permissions, permission{"delete", "", "secrets", pulp.newSubscriptionNamespace})
+	}
+	if pulp.installManifests {
+		for _, p := range pulp.manifestsPermissions(c) {
+			if p.verb == "create" {
+				permissions = append(permissions, permission{"delete", p.group, p.resource, p.namespace})
+			}
+		}
+	} else {
+		permissions = append(permissions, []permission{
+			{"delete", "operators.coreos.com", "subscriptions", pulp.newSubscriptionNamespace},
+			{"delete", "operators.coreos.com", "clusterserviceversions", pulp.newSubscriptionNamespace},
+		}...)
+	}
+	if pulp.withoutOLM {
+		permissions = append(permissions, []permission{
+			{"create", "", "serviceaccounts", pulp.oldSubscriptionNamespace},
+			{"create", "rbac.authorization.k8s.io", "roles", pulp.oldSubscriptionNamespace},
+			{"create", "rbac.authorization.k8s.io", "rolebindings", pulp.oldSubscriptionNamespace},
+		}...)
+	} else {
+		permissions = append(permissions, permission{"create", "operators.coreos.com", "subscriptions", pulp.oldSubscriptionNamespace})
+	}
+	if pulp.indexImage != "" && !pulp.installManifests {
+		permissions = append(permissions, permission{"delete", "operators.coreos.com", "catalogsources", pulp.newSubscriptionSourceNamespace})
+	}
+	if pulp.adjustOperatorGroup && !pulp.installManifests {
+		permissions = append(permissions, permission{"delete", "operators.coreos.com", "operatorgroups", pulp.newSubscriptionNamespace})
+	}
+	return permissions
+}
+
+// rollback restores the resources modified by the migrator to the state
+// recorded before the migration started.
+// It does not stop on the first error, it tries to restore as much as it can.
+func (pulp pulp) rollback(c cluster) error {
+	state := pulp.original
+	fmt.Println("⏪ Rolling back the migration ...")
+
+	var rollbackErr error
+	failed := func(msg string, err error) {
+		fmt.Println("❌ "+msg+":", err)
+		rollbackErr = fmt.Errorf("rollback did not finish successfully")
+	}
+
+	if state.GolangCRCreated {
+		fmt.Println("🗑️  Deleting", pulp.newResourceName, "golang Pulp CR ...")
+		if err := pulp.deleteGolangCR(c); err != nil {
+			failed("Failed to delete the golang Pulp CR", err)
+		}
+	}
+
+	if state.ExternalDBSecretCreated {
+		fmt.Println("🗑️  Deleting", pulp.externalDBSecretName(), "secret ...")
+		if err := pulp.deleteExternalDBSecret(c); err != nil {
+			failed("Failed to delete the external database secret", err)
+		}
+	}
+
+	if state.ExternalCacheSecretCreated {
+		fmt.Println("🗑️  Deleting", pulp.externalCacheSecretName(), "secret ...")
+		if err := pulp.deleteExternalCacheSecret(c); err != nil {
+			failed("Failed to delete the external cache secret", err)
+		}
+	}
+
+	if state.NewSubscriptionCreated {
+		fmt.Println("🗑️  Deleting", pulp.newSubscriptionName, "subscription ...")
+		if err := pulp.deleteNewSubscription(c); err != nil {
+			failed("Failed to delete the new Subscription", err)
+		}
+	}
+
+	if state.CatalogSourceCreated {
+		fmt.Println("🗑️  Deleting", pulp.newSubscriptionSource, "catalogsource ...")
+		if err := pulp.deleteCatalogSource(c); err != nil {
+			failed("Failed to delete the CatalogSource", err)
+		}
+	}
+
+	if state.OperatorGroupCreated || state.OperatorGroup != nil {
+		fmt.Println("Restoring the OperatorGroup of", pulp.newSubscriptionNamespace, "namespace ...")
+		if err := pulp.restoreOperatorGroup(c); err != nil {
+			failed("Failed to restore the OperatorGroup", err)
+		}
+	}
+
+	if len(state.OperatorObjects) > 0 {
+		fmt.Println("🗑️  Deleting the golang operator installed from its manifests ...")
+		if err := pulp.deleteOperatorManifests(c); err != nil {
+			failed("Failed to delete the golang operator", err)
+		}
+	}
+
+	if state.ServiceUpdated {
+		fmt.Println("Restoring " + pulp.oldDBSVC + " Database Service selector ...")
+		patch, err := json.Marshal([]map[string]any{
+			{"op": "replace", "path": "/spec/selector", "value": state.ServiceSelector},
+		})
+		if err == nil {
+			svc := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: pulp.oldDBSVC, Namespace: pulp.oldSubscriptionNamespace}}
+			err = pulp.patch(c, svc, client.RawPatch(types.JSONPatchType, patch))
+		}
+		if err != nil {
+			failed("Failed to restore Database Service selector", err)
+		}
+	}
+
+	if state.StsDownscaled {
+		fmt.Println("Scaling old Database STS back to", state.StsReplicas, "replicas ...")
+		if err := pulp.scaleDBSts(c, state.StsReplicas); err != nil {
+			failed("Failed to scale "+pulp.oldDBSts+" STS", err)
+		}
+	}
+
+	if state.DeploymentsDeleted {
+		for _, deployment := range state.Deployments {
+			fmt.Println("Recreating", deployment.Name, "deployment ...")
+			deployment.ObjectMeta = cleanObjectMeta(deployment.ObjectMeta)
+			deployment.Status = appsv1.DeploymentStatus{}
+			err := pulp.create(c, &deployment)
+			if err != nil && !apierrors.IsAlreadyExists(err) {
+				failed("Failed to recreate "+deployment.Name+" deployment", err)
+			}
+		}
+	}
+
+	if state.SubscriptionDeleted && state.Subscription != nil {
+		fmt.Println("Recreating", pulp.oldSubscriptionName, "subscription ...")
+		subscription := &operatorsv1alpha1.Subscription{
+			TypeMeta:   state.Subscription.TypeMeta,
+			ObjectMeta: cleanObjectMeta(state.Subscription.ObjectMeta),
+			Spec:       state.Subscription.Spec,
+		}
+		// make sure OLM reinstalls the same version that was running before
+		if subscription.Spec != nil && state.CSVName != "" {
+			subscription.Spec.StartingCSV = state.CSVName
+		}
+		if err := pulp.create(c, subscription); err != nil && !apierrors.IsAlreadyExists(err) {
+			failed("Failed to recreate "+pulp.oldSubscriptionName+" subscription", err)
+		}
+	}
+
+	if state.AnsibleOperatorDeleted && state.AnsibleOperator != nil {
+		if err := pulp.restoreAnsibleOperator(c); err != nil {
+			failed("Failed to recreate the ansible operator", err)
+		}
+	}
+
+	if rollbackErr != nil {
+		return rollbackErr
+	}
+	fmt.Println("⏪ Rollback finished")
+	return nil
+}
+
+// deleteGolangCR removes the golang Pulp CR and waits for its database pods
+// to be gone, so they are not running along with the ansible ones on the
+// same PVC when the ansible database is restored
+func (pulp pulp) deleteGolangCR(c cluster) error {
+	cr := newUnstructured(pulp.newApi, pulp.newKind)
+	cr.SetName(pulp.newResourceName)
+	cr.SetNamespace(pulp.newSubscriptionNamespace)
+	if err := pulp.delete(c, cr); err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete %s %s: %w", pulp.newKind, pulp.newResourceName, err)
+	}
+
+	fmt.Println("Waiting for the golang database pods to be removed ...")
+	return waitFor(pulp.operatorTimeout, func() (bool, error) {
+		pods := &corev1.PodList{}
+		labels := client.MatchingLabels{"app": "postgresql", "pulp_cr": pulp.newResourceName}
+		if err := c.List(context.TODO(), pods, client.InNamespace(pulp.newSubscriptionNamespace), labels); err != nil {
+			return false, fmt.Errorf("failed to list the golang database pods: %w", err)
+		}
+		return len(pods.Items) == 0, nil
+	})
+}
+
+// deleteNewSubscription removes the golang operator Subscription and the
+// CSV installed by it
+func (pulp pulp) deleteNewSubscription(c cluster) error {
+	sub, err := pulp.getNewSubscription(c)
+	if apierrors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if err := pulp.delete(c, sub); err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete subscription %s: %w", sub.Name, err)
+	}
+
+	if sub.Status.CurrentCSV == "" {
+		return nil
+	}
+	csv := &operatorsv1alpha1.ClusterServiceVersion{ObjectMeta: metav1.ObjectMeta{Name: sub.Status.CurrentCSV, Namespace: pulp.newSubscriptionNamespace}}
+	if err := pulp.delete(c, csv); err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete CSV %s: %w", csv.Name, err)
+	}
+	return nil
+}
+
+// cleanObjectMeta keeps only the fields of an object metadata that can be
+// provided when recreating it
+func cleanObjectMeta(meta metav1.ObjectMeta) metav1.ObjectMeta {
+	return metav1.ObjectMeta{
+		Name:            meta.Name,
+		Namespace:       meta.Namespace,
+		Labels:          meta.Labels,
+		Annotations:     meta.Annotations,
+		OwnerReferences: meta.OwnerReferences,
+	}
+}
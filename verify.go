@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"migrator/conversion"
+
+	repomanagerv1alpha1 "github.com/pulp/pulp-operator/api/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// nginxIngressController is the controller of the IngressClasses served by
+// ingress-nginx, the golang operator does not deploy the web pods for them
+const nginxIngressController = "k8s.io/ingress-nginx"
+
+// errVerificationFailed is returned when the golang Pulp CR was created but the
+// golang operator did not bring the installation up. Everything was already
+// handed over to the golang operator, so the migration is not rolled back.
+var errVerificationFailed = errors.New("post-migration verification failed")
+
+// verify waits for the golang operator to reconcile the new Pulp CR and checks
+// that the installation is working, reporting a pass/fail verdict.
+// The checks are retried until all of them pass or the timeout is reached.
+func (pulp pulp) verify(c cluster) error {
+	if pulp.dryRun {
+		fmt.Println("📝 [dry-run] Verifying", pulp.newResourceName, "after the golang operator reconciles it")
+		return nil
+	}
+
+	fmt.Println("🔎 Verifying the migrated installation (waiting up to", pulp.verifyTimeout, "for the golang operator) ...")
+	var failures map[string]error
+	var checks []preflightCheck
+	waitFor(pulp.verifyTimeout, func() (bool, error) {
+		checks = pulp.verificationChecks(c)
+		failures = map[string]error{}
+		for _, check := range checks {
+			if err := check.run(); err != nil {
+				failures[check.name] = err
+			}
+		}
+		if len(failures) > 0 {
+			fmt.Printf("Waiting for the golang operator (%d/%d checks passed) ...\n", len(checks)-len(failures), len(checks))
+		}
+		return len(failures) == 0, nil
+	})
+
+	for _, check := range checks {
+		if err, failed := failures[check.name]; failed {
+			fmt.Println("  ❌", check.name+":", err)
+			continue
+		}
+		fmt.Println("  ✅", check.name)
+	}
+	if len(failures) > 0 {
+		fmt.Println("❌ Post-migration verification failed, check the golang operator logs and the", pulp.newResourceName, "status")
+		return fmt.Errorf("%w: %d checks failed", errVerificationFailed, len(failures))
+	}
+	fmt.Println("✅ Post-migration verification passed")
+	return nil
+}
+
+// verificationChecks returns the checks of the migrated installation, based
+// on the golang Pulp CR spec
+func (pulp pulp) verificationChecks(c cluster) []preflightCheck {
+	pulpNew := &repomanagerv1alpha1.Pulp{}
+	checks := []preflightCheck{
+		{"golang Pulp CR " + pulp.newResourceName + " finished reconciling", func() error { return pulp.checkGolangCRReconciled(c, pulpNew) }},
+	}
+	// the other checks depend on the spec, so they are only known once the CR is found
+	if checks[0].run() != nil {
+		return checks
+	}
+
+	components := []string{"api", "content", "worker"}
+	if pulp.needsWeb(c, pulpNew.Spec) {
+		components = append(components, "web")
+	}
+	for _, component := range components {
+		name := pulp.newResourceName + "-" + component
+		checks = append(checks, preflightCheck{"Deployment " + name + " is ready", func() error { return pulp.checkDeploymentReady(c, name) }})
+	}
+	if !pulp.externalDB {
+		name := pulp.newResourceName + "-database"
+		checks = append(checks, preflightCheck{"StatefulSet " + name + " is ready", func() error { return pulp.checkStatefulSetReady(c, name) }})
+		if pulp.oldDBPVC != "" {
+			checks = append(checks, preflightCheck{"database pod mounts " + pulp.oldDBPVC + " PVC", func() error { return pulp.checkDBPVCMounted(c, name) }})
+		}
+	}
+	checks = append(checks, preflightCheck{"Pulp status endpoint reports the database connected", func() error {
+		return pulp.checkStatusEndpoint(c, conversion.APIRoot(pulpNew.Spec.PulpSettings))
+	}})
+	return checks
+}
+
+// needsWeb returns true if the golang operator deploys the web pods, which
+// are not needed with a route or an ingress of the nginx class
+func (pulp pulp) needsWeb(c cluster, spec repomanagerv1alpha1.PulpSpec) bool {
+	if strings.ToLower(spec.IngressType) == "route" {
+		return false
+	}
+	// same as the golang operator, the class is ignored if it is not found
+	class := &networkingv1.IngressClass{}
+	if err := c.Get(context.TODO(), client.ObjectKey{Name: spec.IngressClassName}, class); err != nil {
+		return true
+	}
+	return class.Spec.Controller != nginxIngressController
+}
+
+// checkGolangCRReconciled verifies that the golang operator finished the
+// reconciliation of the new Pulp CR, which is stored in pulpNew
+func (pulp pulp) checkGolangCRReconciled(c cluster, pulpNew *repomanagerv1alpha1.Pulp) error {
+	cr := newUnstructured(pulp.newApi, pulp.newKind)
+	err := c.Get(context.TODO(), client.ObjectKey{Namespace: pulp.newSubscriptionNamespace, Name: pulp.newResourceName}, cr)
+	if isMissing(err) {
+		return fmt.Errorf("not found")
+	} else if err != nil {
+		return fmt.Errorf("failed to get it: %w", err)
+	}
+	if err := fromUnstructured(cr.Object, pulpNew); err != nil {
+		return fmt.Errorf("failed to read it: %w", err)
+	}
+
+	deploymentType := pulpNew.Spec.DeploymentType
+	if deploymentType == "" {
+		deploymentType = "pulp"
+	}
+	conditionType := strings.ToUpper(deploymentType[:1]) + deploymentType[1:] + "-Operator-Finished-Execution"
+	for _, condition := range pulpNew.Status.Conditions {
+		if condition.Type == conditionType && condition.Status == metav1.ConditionTrue {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s condition is not True", conditionType)
+}
+
+// checkDeploymentReady verifies that every replica of the deployment is ready
+func (pulp pulp) checkDeploymentReady(c cluster, name string) error {
+	deployment := &appsv1.Deployment{}
+	err := c.Get(context.TODO(), client.ObjectKey{Namespace: pulp.newSubscriptionNamespace, Name: name}, deployment)
+	if apierrors.IsNotFound(err) {
+		return fmt.Errorf("not found")
+	} else if err != nil {
+		return fmt.Errorf("failed to get it: %w", err)
+	}
+	replicas := int32(1)
+	if deployment.Spec.Replicas != nil {
+		replicas = *deployment.Spec.Replicas
+	}
+	if deployment.Status.ReadyReplicas < replicas {
+		return fmt.Errorf("%d/%d replicas ready", deployment.Status.ReadyReplicas, replicas)
+	}
+	return nil
+}
+
+// checkStatefulSetReady verifies that every replica of the statefulset is ready
+func (pulp pulp) checkStatefulSetReady(c cluster, name string) error {
+	sts, err := pulp.getStatefulSet(c, name)
+	if err != nil {
+		return err
+	}
+	replicas := int32(1)
+	if sts.Spec.Replicas != nil {
+		replicas = *sts.Spec.Replicas
+	}
+	if sts.Status.ReadyReplicas < replicas {
+		return fmt.Errorf("%d/%d replicas ready", sts.Status.ReadyReplicas, replicas)
+	}
+	return nil
+}
+
+func (pulp pulp) getStatefulSet(c cluster, name string) (*appsv1.StatefulSet, error) {
+	sts := &appsv1.StatefulSet{}
+	err := c.Get(context.TODO(), client.ObjectKey{Namespace: pulp.newSubscriptionNamespace, Name: name}, sts)
+	if apierrors.IsNotFound(err) {
+		return nil, fmt.Errorf("not found")
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to get it: %w", err)
+	}
+	return sts, nil
+}
+
+// checkDBPVCMounted verifies that the database pods of the golang operator
+// use the PVC of the ansible database pods, so the data was carried over
+func (pulp pulp) checkDBPVCMounted(c cluster, stsName string) error {
+	sts, err := pulp.getStatefulSet(c, stsName)
+	if err != nil {
+		return err
+	}
+	selector, err := metav1.LabelSelectorAsSelector(sts.Spec.Selector)
+	if err != nil {
+		return err
+	}
+	pods := &corev1.PodList{}
+	if err := c.List(context.TODO(), pods, client.InNamespace(pulp.newSubscriptionNamespace), client.MatchingLabelsSelector{Selector: selector}); err != nil {
+		return fmt.Errorf("failed to list the database pods: %w", err)
+	}
+	if len(pods.Items) == 0 {
+		return fmt.Errorf("no database pod found")
+	}
+	for _, pod := range pods.Items {
+		for _, volume := range pod.Spec.Volumes {
+			if volume.PersistentVolumeClaim != nil && volume.PersistentVolumeClaim.ClaimName == pulp.oldDBPVC {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("the database pods do not mount it")
+}
+
+// checkStatusEndpoint calls the Pulp status endpoint through the api Service
+// (proxied by the API server) and verifies the database connection
+func (pulp pulp) checkStatusEndpoint(c cluster, apiRoot string) error {
+	data, err := c.proxyGet(pulp.newSubscriptionNamespace, pulp.newResourceName+"-api-svc", "24817", apiRoot+"api/v3/status/")
+	if err != nil {
+		return fmt.Errorf("failed to reach the status endpoint: %w", err)
+	}
+	status := struct {
+		DatabaseConnection struct {
+			Connected bool `json:"connected"`
+		} `json:"database_connection"`
+	}{}
+	if err := json.Unmarshal(data, &status); err != nil {
+		return fmt.Errorf("unexpected response: %w", err)
+	}
+	if !status.DatabaseConnection.Connected {
+		return fmt.Errorf("database is not connected")
+	}
+	return nil
+}